@@ -9,71 +9,17 @@ KSOPS, or kustomize-SOPS, is a kustomize plugin for SOPS encrypted resources. KS
 package main
 
 import (
-	"bytes"
-	"encoding/base64"
+	"context"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
-	"strconv"
 	"strings"
 
 	"github.com/GoogleContainerTools/kpt-functions-sdk/go/fn"
-	"github.com/getsops/sops/v3/cmd/sops/formats"
-	"github.com/getsops/sops/v3/decrypt"
-	"github.com/joho/godotenv"
-	"golang.org/x/sync/errgroup"
-	"sigs.k8s.io/kustomize/api/types"
-	"sigs.k8s.io/yaml"
+	"github.com/viaduct-ai/kustomize-sops/pkg/ksops"
 )
 
-type keyData struct {
-	key  string
-	data []byte
-}
-
-// decryptAll concurrently decrypts a list of files using the provided errgroup,
-// returning results in the same order as the input.
-func decryptAll[T any](g *errgroup.Group, items []string, fn func(file string) (T, error)) ([]T, error) {
-	results := make([]T, len(items))
-	for i, file := range items {
-		g.Go(func() error {
-			v, err := fn(file)
-			if err != nil {
-				return err
-			}
-			results[i] = v
-			return nil
-		})
-	}
-	if err := g.Wait(); err != nil {
-		return nil, err
-	}
-	return results, nil
-}
-
-type kubernetesSecret struct {
-	APIVersion string            `json:"apiVersion" yaml:"apiVersion"`
-	Kind       string            `json:"kind" yaml:"kind"`
-	Metadata   types.ObjectMeta  `json:"metadata" yaml:"metadata"`
-	Type       string            `json:"type,omitempty" yaml:"type,omitempty"`
-	StringData map[string]string `json:"stringData,omitempty" yaml:"stringData,omitempty"`
-	Data       map[string]string `json:"data,omitempty" yaml:"data,omitempty"`
-}
-
-type secretFrom struct {
-	Files       []string         `json:"files,omitempty" yaml:"files,omitempty"`
-	BinaryFiles []string         `json:"binaryFiles,omitempty" yaml:"binaryFiles,omitempty"`
-	Envs        []string         `json:"envs,omitempty" yaml:"envs,omitempty"`
-	Metadata    types.ObjectMeta `json:"metadata,omitempty" yaml:"metadata,omitempty"`
-	Type        string           `json:"type,omitempty" yaml:"type,omitempty"`
-}
-
-type ksops struct {
-	Files      []string     `json:"files,omitempty" yaml:"files,omitempty"`
-	SecretFrom []secretFrom `json:"secretFrom,omitempty" yaml:"secretFrom,omitempty"`
-}
-
 func help() {
 	msg := `
 		KSOPS is a flexible kustomize plugin for SOPS encrypted resources.
@@ -172,6 +118,13 @@ func main() {
 		help()
 	}
 
+	// The KSOPS_* environment variables take precedence over the manifest
+	opts, err := ksops.OptionsFromEnv()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to generate manifests: %v\n", err)
+		os.Exit(1)
+	}
+
 	// If one argument, assume KRM style
 	if nargs == 1 {
 		// https://stackoverflow.com/questions/22744443/check-if-there-is-something-to-read-on-stdin-in-golang
@@ -181,7 +134,7 @@ func main() {
 		if !(stat.Mode()&os.ModeCharDevice == 0) {
 			help()
 		}
-		err := fn.AsMain(fn.ResourceListProcessorFunc(krm))
+		err = fn.AsMain(fn.ResourceListProcessorFunc(ksops.New(opts...).Process))
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "unable to generate manifests: %v\n", err)
 			os.Exit(1)
@@ -193,187 +146,28 @@ func main() {
 
 	// ignore the first file name argument
 	// load the second argument, the file path
-	manifest, err := os.ReadFile(os.Args[1])
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "unable to read in manifest: %s\n", os.Args[1])
-		os.Exit(1)
-	}
-
-	result, err := generate(manifest)
+	objs, results, err := ksops.New(opts...).GenerateFile(context.Background(), os.Args[1])
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "unable to generate manifests: %v\n", err)
 		os.Exit(1)
 	}
-
-	fmt.Print(result)
-}
-
-// https://pkg.go.dev/github.com/GoogleContainerTools/kpt-functions-sdk/go/fn#hdr-KRM_Function
-func krm(rl *fn.ResourceList) (bool, error) {
-	var items fn.KubeObjects
-	for _, manifest := range rl.Items {
-		out, err := generate([]byte(manifest.String()))
-		if err != nil {
-			rl.LogResult(err)
-			return false, err
-		}
-
-		// generate can return multiple manifests
-		objs, err := fn.ParseKubeObjects([]byte(out))
-		if err != nil {
-			rl.LogResult(err)
-			return false, err
-		}
-
-		items = append(items, objs...)
+	for _, r := range results {
+		fmt.Fprintf(os.Stderr, "%s\n", r)
 	}
 
-	rl.Items = items
-
-	return true, nil
+	fmt.Print(marshalObjects(objs))
 }
 
-func generate(raw []byte) (string, error) {
-	var manifest ksops
-	err := yaml.Unmarshal(raw, &manifest)
-
-	if err != nil {
-		return "", fmt.Errorf("error unmarshalling manifest content: %q \n%s", err, raw)
-	}
-
-	if manifest.Files == nil && manifest.SecretFrom == nil {
-		return "", fmt.Errorf("missing the required 'files' or 'secretFrom' key in the ksops manifests: %s", raw)
-	}
-
-	var g errgroup.Group
-	limit := 20
-	if l := os.Getenv("KSOPS_CONCURRENCY_LIMIT"); l != "" {
-		limit, err = strconv.Atoi(l)
-		if err != nil || limit < 1 {
-			return "", fmt.Errorf("error parsing KSOPS_CONCURRENCY_LIMIT value %q: %w", l, err)
+// marshalObjects serializes objs as a stream of YAML documents. Unlike
+// fn.KubeObjects.String, it keeps the trailing newlines of block scalars
+// ending a document.
+func marshalObjects(objs fn.KubeObjects) string {
+	var b strings.Builder
+	for i, obj := range objs {
+		if i > 0 {
+			b.WriteString("---\n")
 		}
+		b.WriteString(obj.String())
 	}
-	g.SetLimit(limit)
-
-	// Decrypt manifest.Files concurrently
-	decrypted, err := decryptAll(&g, manifest.Files, func(file string) ([]byte, error) {
-		data, err := decryptFile(file)
-		if err != nil {
-			return nil, fmt.Errorf("error decrypting file %q from manifest.Files: %w", file, err)
-		}
-		return data, nil
-	})
-	if err != nil {
-		return "", err
-	}
-
-	var output bytes.Buffer
-	for i, data := range decrypted {
-		output.Write(data)
-		// KRM treats will try parse (and fail) empty documents if there is a trailing separator
-		if i < (len(manifest.Files)+len(manifest.SecretFrom))-1 {
-			output.WriteString("\n---\n")
-		}
-	}
-
-	for i, sf := range manifest.SecretFrom {
-		fileResults, err := decryptAll(&g, sf.Files, func(file string) (keyData, error) {
-			key, path := fileKeyPath(file)
-			data, err := decryptFile(path)
-			if err != nil {
-				return keyData{}, fmt.Errorf("error decrypting file %q from secretFrom.Files: %w", path, err)
-			}
-			return keyData{key: key, data: data}, nil
-		})
-		if err != nil {
-			return "", err
-		}
-
-		binaryResults, err := decryptAll(&g, sf.BinaryFiles, func(file string) (keyData, error) {
-			key, path := fileKeyPath(file)
-			data, err := decryptFile(path)
-			if err != nil {
-				return keyData{}, fmt.Errorf("error decrypting file %q from secretFrom.BinaryFiles: %w", path, err)
-			}
-			return keyData{key: key, data: data}, nil
-		})
-		if err != nil {
-			return "", err
-		}
-
-		envResults, err := decryptAll(&g, sf.Envs, func(file string) (keyData, error) {
-			data, err := decryptFile(file)
-			if err != nil {
-				return keyData{}, fmt.Errorf("error decrypting file %q from secretFrom.Envs: %w", file, err)
-			}
-			return keyData{key: file, data: data}, nil
-		})
-		if err != nil {
-			return "", err
-		}
-
-		stringData := make(map[string]string)
-		binaryData := make(map[string]string)
-
-		for _, r := range fileResults {
-			stringData[r.key] = string(r.data)
-		}
-		for _, r := range binaryResults {
-			binaryData[r.key] = base64.StdEncoding.EncodeToString(r.data)
-		}
-		for _, r := range envResults {
-			env, err := godotenv.Unmarshal(string(r.data))
-			if err != nil {
-				return "", fmt.Errorf("error unmarshalling .env file %q: %w", r.key, err)
-			}
-			for k, v := range env {
-				stringData[k] = v
-			}
-		}
-
-		s := kubernetesSecret{
-			APIVersion: "v1",
-			Kind:       "Secret",
-			Metadata:   sf.Metadata,
-			Type:       sf.Type,
-			StringData: stringData,
-			Data:       binaryData,
-		}
-		d, err := yaml.Marshal(&s)
-		if err != nil {
-			return "", fmt.Errorf("error marshalling manifest: %w", err)
-		}
-		output.WriteString(string(d))
-		// KRM treats will try parse (and fail) empty documents if there is a trailing separator
-		if i < len(manifest.SecretFrom)-1 {
-			output.WriteString("---\n")
-		}
-	}
-
-	return output.String(), nil
-}
-
-func decryptFile(file string) ([]byte, error) {
-	b, err := os.ReadFile(file)
-	if err != nil {
-		return nil, fmt.Errorf("error reading %q: %w", file, err)
-	}
-
-	format := formats.FormatForPath(file)
-	data, err := decrypt.DataWithFormat(b, format)
-	if err != nil {
-		return nil, fmt.Errorf("trouble decrypting file: %w", err)
-	}
-	return data, nil
-}
-
-func fileKeyPath(file string) (string, string) {
-	slices := strings.Split(file, "=")
-	if len(slices) == 1 {
-		return filepath.Base(file), file
-	} else if len(slices) > 2 {
-		fmt.Fprintf(os.Stderr, "invalid format in file generator %s\n", file)
-		os.Exit(1)
-	}
-	return slices[0], slices[1]
+	return b.String()
 }
@@ -115,6 +115,46 @@ func TestKSOPSPluginInstallation(t *testing.T) {
 			name: "KRM Secret Metadata",
 			dir:  "test/krm/metadata",
 		},
+		{
+			name: "KRM ConfigMap From",
+			dir:  "test/krm/configmap",
+		},
+		{
+			name: "KRM Secret Literals",
+			dir:  "test/krm/literals",
+		},
+		{
+			name: "KRM Glob and Directory",
+			dir:  "test/krm/glob",
+		},
+		{
+			name: "KRM Value Selector",
+			dir:  "test/krm/selector",
+		},
+		{
+			name: "KRM Structured Envs",
+			dir:  "test/krm/structuredenvs",
+		},
+		{
+			name: "KRM Generator Options",
+			dir:  "test/krm/options",
+		},
+		{
+			name: "KRM Docker Config Secret",
+			dir:  "test/krm/dockerconfig",
+		},
+		{
+			name: "KRM TLS Secret",
+			dir:  "test/krm/tls",
+		},
+		{
+			name: "KRM Transformer",
+			dir:  "test/krm/transformer",
+		},
+		{
+			name: "KRM Placeholders",
+			dir:  "test/krm/placeholders",
+		},
 	}
 
 	// run kustomize version to validate installation
@@ -0,0 +1,38 @@
+// Copyright 2026 viaduct.ai
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/GoogleContainerTools/kpt-functions-sdk/go/fn"
+)
+
+func TestMarshalObjects(t *testing.T) {
+	objs, err := fn.ParseKubeObjects([]byte(`apiVersion: v1
+kind: Secret
+metadata:
+  name: first
+stringData:
+  file: |
+    line
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: second
+`))
+	if err != nil {
+		t.Fatalf("failed to parse objects: %v", err)
+	}
+	got := marshalObjects(objs)
+	if !strings.Contains(got, "file: |\n    line\n---\n") {
+		t.Errorf("expected the block scalar to keep its trailing newline:\n%s", got)
+	}
+	parsed, err := fn.ParseKubeObjects([]byte(got))
+	if err != nil || len(parsed) != 2 {
+		t.Errorf("expected 2 documents, got %d: %v", len(parsed), err)
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright 2026 viaduct.ai
+// SPDX-License-Identifier: Apache-2.0
+
+package ksops
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Policies for keys that are set by more than one source of a secretFrom or
+// configMapFrom entry.
+const (
+	onConflictError = "error"
+	onConflictFirst = "first"
+	onConflictLast  = "last"
+)
+
+// keyCollector gathers the string and binary data of a generated Secret or
+// ConfigMap. It remembers the source of every key so a key set twice, in
+// either map, is reported with both origins or resolved by the policy.
+type keyCollector struct {
+	policy     string
+	stringData map[string]string
+	binaryData map[string]string
+	origins    map[string]string
+}
+
+func newKeyCollector(policy string) (*keyCollector, error) {
+	switch policy {
+	case "":
+		policy = onConflictError
+	case onConflictError, onConflictFirst, onConflictLast:
+	default:
+		return nil, fmt.Errorf("invalid onConflict value %q: must be one of first, last or error", policy)
+	}
+	return &keyCollector{
+		policy:     policy,
+		stringData: make(map[string]string),
+		binaryData: make(map[string]string),
+		origins:    make(map[string]string),
+	}, nil
+}
+
+// add sets key to value in the string data, or in the binary data if binary is set.
+func (c *keyCollector) add(key, value, origin string, binary bool) error {
+	if prev, ok := c.origins[key]; ok {
+		switch c.policy {
+		case onConflictFirst:
+			return nil
+		case onConflictLast:
+			delete(c.stringData, key)
+			delete(c.binaryData, key)
+		default:
+			return fmt.Errorf("key %q from %s conflicts with the same key from %s", key, origin, prev)
+		}
+	}
+
+	c.origins[key] = origin
+	if binary {
+		c.binaryData[key] = value
+	} else {
+		c.stringData[key] = value
+	}
+	return nil
+}
+
+// addAll adds every key of data in sorted order, so conflicts are reported deterministically.
+func (c *keyCollector) addAll(data map[string]string, origin string) error {
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if err := c.add(k, data[k], origin, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
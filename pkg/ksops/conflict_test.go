@@ -0,0 +1,155 @@
+// Copyright 2026 viaduct.ai
+// SPDX-License-Identifier: Apache-2.0
+
+package ksops
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestKeyCollector(t *testing.T) {
+	tests := []struct {
+		policy     string
+		stringData map[string]string
+		binaryData map[string]string
+		wantErr    string
+	}{
+		{
+			policy:  "",
+			wantErr: `key "a" from second conflicts with the same key from first`,
+		},
+		{
+			policy:  "error",
+			wantErr: `key "a" from second conflicts with the same key from first`,
+		},
+		{
+			policy:     "first",
+			stringData: map[string]string{"a": "1", "b": "2"},
+			binaryData: map[string]string{},
+		},
+		{
+			policy:     "last",
+			stringData: map[string]string{"b": "2"},
+			binaryData: map[string]string{"a": "MQ=="},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.policy, func(t *testing.T) {
+			c, err := newKeyCollector(tc.policy)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if err := c.add("a", "1", "first", false); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if err := c.add("b", "2", "first", false); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			err = c.add("a", "MQ==", "second", true)
+			if tc.wantErr != "" {
+				if err == nil || err.Error() != tc.wantErr {
+					t.Fatalf("expected error %q, got %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(c.stringData, tc.stringData) {
+				t.Errorf("stringData = %v, want %v", c.stringData, tc.stringData)
+			}
+			if !reflect.DeepEqual(c.binaryData, tc.binaryData) {
+				t.Errorf("binaryData = %v, want %v", c.binaryData, tc.binaryData)
+			}
+		})
+	}
+}
+
+func TestKeyCollectorInvalidPolicy(t *testing.T) {
+	if _, err := newKeyCollector("merge"); err == nil {
+		t.Fatal("expected error for an invalid onConflict policy")
+	}
+}
+
+func TestGenerateKeyCollisions(t *testing.T) {
+	importTestKey(t)
+
+	envs := testFixturePath(t, "test", "legacy", "envs", "secret.enc.env")
+	file := testFixturePath(t, "test", "legacy", "file", "secret.enc.yaml")
+
+	t.Run("env and literal", func(t *testing.T) {
+		manifest := makeManifest(nil, `secretFrom:
+- metadata:
+    name: mysecret
+  envs:
+  - `+envs+`
+  literals:
+  - username=other`)
+		_, _, err := generate(context.Background(), manifest, "")
+		if err == nil {
+			t.Fatal("expected error for a key collision")
+		}
+		for _, want := range []string{`"username"`, "literal", envs} {
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("error should mention %q: %v", want, err)
+			}
+		}
+	})
+
+	t.Run("file and binary file", func(t *testing.T) {
+		manifest := makeManifest(nil, `secretFrom:
+- metadata:
+    name: mysecret
+  files:
+  - `+file+`
+  binaryFiles:
+  - `+file)
+		_, _, err := generate(context.Background(), manifest, "")
+		if err == nil {
+			t.Fatal("expected error for a key collision")
+		}
+		if !strings.Contains(err.Error(), "secretFrom[0].binaryFiles[0]") || !strings.Contains(err.Error(), "secretFrom[0].files[0]") {
+			t.Errorf("error should name both origins: %v", err)
+		}
+	})
+
+	t.Run("env files with last policy", func(t *testing.T) {
+		manifest := makeManifest(nil, `secretFrom:
+- metadata:
+    name: mysecret
+  onConflict: last
+  envs:
+  - `+envs+`
+  literals:
+  - username=other`)
+		got, _, err := generate(context.Background(), manifest, "")
+		if err != nil {
+			t.Fatalf("generate failed: %v", err)
+		}
+		if !strings.Contains(got, "username: other") {
+			t.Errorf("the last value should win:\n%s", got)
+		}
+	})
+
+	t.Run("env files with first policy", func(t *testing.T) {
+		manifest := makeManifest(nil, `secretFrom:
+- metadata:
+    name: mysecret
+  onConflict: first
+  envs:
+  - `+envs+`
+  literals:
+  - username=other`)
+		got, _, err := generate(context.Background(), manifest, "")
+		if err != nil {
+			t.Fatalf("generate failed: %v", err)
+		}
+		if !strings.Contains(got, "username: admin") {
+			t.Errorf("the first value should win:\n%s", got)
+		}
+	})
+}
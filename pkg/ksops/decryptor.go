@@ -0,0 +1,53 @@
+// Copyright 2026 viaduct.ai
+// SPDX-License-Identifier: Apache-2.0
+
+package ksops
+
+import (
+	"context"
+
+	"github.com/getsops/sops/v3/cmd/sops/formats"
+	"github.com/getsops/sops/v3/decrypt"
+)
+
+// Decryptor decrypts SOPS encrypted content in the given format. Decrypt
+// should return once ctx is done, which happens when a timeout is exceeded or
+// another decryption fails.
+type Decryptor interface {
+	Decrypt(ctx context.Context, data []byte, format formats.Format) ([]byte, error)
+}
+
+// DecryptorFunc adapts a function to a Decryptor.
+type DecryptorFunc func(ctx context.Context, data []byte, format formats.Format) ([]byte, error)
+
+// Decrypt calls f.
+func (f DecryptorFunc) Decrypt(ctx context.Context, data []byte, format formats.Format) ([]byte, error) {
+	return f(ctx, data, format)
+}
+
+// sopsDecryptor is the default Decryptor, decrypting with SOPS. SOPS decryption
+// cannot be interrupted, so a decryption still pending when ctx is done is
+// abandoned: Decrypt returns, but the SOPS call keeps running in its goroutine
+// until the key provider answers.
+type sopsDecryptor struct{}
+
+func (sopsDecryptor) Decrypt(ctx context.Context, data []byte, format formats.Format) ([]byte, error) {
+	if ctx.Done() == nil {
+		return decrypt.DataWithFormat(data, format)
+	}
+	type result struct {
+		data []byte
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		data, err := decrypt.DataWithFormat(data, format)
+		done <- result{data, err}
+	}()
+	select {
+	case r := <-done:
+		return r.data, r.err
+	case <-ctx.Done():
+		return nil, context.Cause(ctx)
+	}
+}
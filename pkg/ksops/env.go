@@ -0,0 +1,286 @@
+// Copyright 2026 viaduct.ai
+// SPDX-License-Identifier: Apache-2.0
+
+package ksops
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/getsops/sops/v3/cmd/sops/formats"
+	"github.com/joho/godotenv"
+	goyaml "go.yaml.in/yaml/v3"
+)
+
+const defaultEnvSeparator = "."
+
+// EnvSource is an envs entry. It is either a plain path, or an object that
+// also sets the format of the decrypted content, the SOPS format the file is
+// decrypted as and the separator used to flatten nested keys.
+type EnvSource struct {
+	Path   string `json:"path" yaml:"path"`
+	Format string `json:"format,omitempty" yaml:"format,omitempty"`
+	// SopsFormat overrides the SOPS format of the file, like the format of a
+	// files entry, while Format is the format its decrypted content is parsed
+	// as.
+	SopsFormat string `json:"sopsFormat,omitempty" yaml:"sopsFormat,omitempty"`
+	Separator  string `json:"separator,omitempty" yaml:"separator,omitempty"`
+}
+
+// UnmarshalJSON accepts either a plain path or an object.
+func (e *EnvSource) UnmarshalJSON(b []byte) error {
+	var path string
+	if err := json.Unmarshal(b, &path); err == nil {
+		*e = EnvSource{Path: path}
+		return nil
+	}
+
+	type plain EnvSource
+	var p plain
+	if err := json.Unmarshal(b, &p); err != nil {
+		return fmt.Errorf("envs entries must be a path or an object with a path: %w", err)
+	}
+	*e = EnvSource(p)
+	return nil
+}
+
+// expandEnvSources is expandPath for envs entries. Every file an entry
+// expands to keeps the entry's formats and separator.
+func (l fileLoader) expandEnvSources(sources []EnvSource) ([]EnvSource, error) {
+	var expanded []EnvSource
+	for _, source := range sources {
+		if source.Path == "" {
+			return nil, fmt.Errorf("envs entry is missing a path")
+		}
+		files, err := l.expandPath(source.Path)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			s := source
+			s.Path = file
+			expanded = append(expanded, s)
+		}
+	}
+	return expanded, nil
+}
+
+// envFormat returns the format of an env source's decrypted content: the
+// explicit format if set, otherwise the one matching the file extension.
+// Files with unknown extensions are parsed as dotenv files.
+func envFormat(source EnvSource) (string, error) {
+	switch strings.ToLower(source.Format) {
+	case "":
+	case "env", "dotenv":
+		return "dotenv", nil
+	case "yaml", "yml":
+		return "yaml", nil
+	case "json", "ini", "properties":
+		return strings.ToLower(source.Format), nil
+	default:
+		return "", fmt.Errorf("unsupported env format %q: must be one of dotenv, yaml, json, ini or properties", source.Format)
+	}
+
+	switch strings.ToLower(filepath.Ext(source.Path)) {
+	case ".yaml", ".yml":
+		return "yaml", nil
+	case ".json":
+		return "json", nil
+	case ".ini":
+		return "ini", nil
+	case ".properties":
+		return "properties", nil
+	default:
+		return "dotenv", nil
+	}
+}
+
+// parseEnv parses decrypted env content into keys and values. Nested maps,
+// lists and INI sections are flattened, joining the keys with separator.
+func parseEnv(data []byte, format, separator string) (map[string]string, error) {
+	if separator == "" {
+		separator = defaultEnvSeparator
+	}
+
+	var node *goyaml.Node
+	var err error
+	switch format {
+	case "dotenv":
+		return godotenv.Unmarshal(string(data))
+	case "properties":
+		return parseProperties(data)
+	case "yaml":
+		node, err = parseDocument(data, formats.Yaml)
+	case "json":
+		node, err = parseDocument(data, formats.Json)
+	case "ini":
+		node, err = parseDocument(data, formats.Ini)
+	default:
+		return nil, fmt.Errorf("unsupported env format %q", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for node.Kind == goyaml.AliasNode {
+		node = node.Alias
+	}
+	if node.Kind != goyaml.MappingNode {
+		return nil, fmt.Errorf("%s env content must be a map of keys to values", format)
+	}
+
+	env := make(map[string]string)
+	flattenNode(node, "", separator, env)
+	return env, nil
+}
+
+// flattenNode adds the scalar values below node to env, keyed by their path
+// from the root joined with separator. List items are keyed by their index.
+func flattenNode(node *goyaml.Node, prefix, separator string, env map[string]string) {
+	for node.Kind == goyaml.AliasNode {
+		node = node.Alias
+	}
+
+	join := func(key string) string {
+		if prefix == "" {
+			return key
+		}
+		return prefix + separator + key
+	}
+
+	switch node.Kind {
+	case goyaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			flattenNode(node.Content[i+1], join(node.Content[i].Value), separator, env)
+		}
+	case goyaml.SequenceNode:
+		for i, item := range node.Content {
+			flattenNode(item, join(strconv.Itoa(i)), separator, env)
+		}
+	default:
+		if node.Tag == "!!null" {
+			env[prefix] = ""
+			return
+		}
+		env[prefix] = node.Value
+	}
+}
+
+// parseProperties parses a Java .properties file. It supports '=', ':' and
+// whitespace separators, '#' and '!' comments, line continuations and the
+// standard escape sequences.
+func parseProperties(data []byte) (map[string]string, error) {
+	props := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+
+	var logical strings.Builder
+	for scanner.Scan() {
+		line := strings.TrimLeft(scanner.Text(), " \t\f")
+		if logical.Len() == 0 && (line == "" || line[0] == '#' || line[0] == '!') {
+			continue
+		}
+
+		// A line ending in an odd number of backslashes continues on the next line
+		trailing := len(line) - len(strings.TrimRight(line, `\`))
+		if trailing%2 == 1 {
+			logical.WriteString(line[:len(line)-1])
+			continue
+		}
+		logical.WriteString(line)
+
+		key, value, err := splitProperty(logical.String())
+		if err != nil {
+			return nil, err
+		}
+		props[key] = value
+		logical.Reset()
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading properties: %w", err)
+	}
+	if logical.Len() > 0 {
+		key, value, err := splitProperty(logical.String())
+		if err != nil {
+			return nil, err
+		}
+		props[key] = value
+	}
+	return props, nil
+}
+
+// splitProperty splits a logical .properties line into its unescaped key and value.
+func splitProperty(line string) (string, string, error) {
+	end := len(line)
+	for i := 0; i < len(line); i++ {
+		if line[i] == '\\' {
+			i++
+			continue
+		}
+		if line[i] == '=' || line[i] == ':' || line[i] == ' ' || line[i] == '\t' || line[i] == '\f' {
+			end = i
+			break
+		}
+	}
+
+	key, err := unescapeProperty(line[:end])
+	if err != nil {
+		return "", "", err
+	}
+
+	rest := strings.TrimLeft(line[end:], " \t\f")
+	if rest != "" && (rest[0] == '=' || rest[0] == ':') {
+		rest = strings.TrimLeft(rest[1:], " \t\f")
+	}
+	value, err := unescapeProperty(rest)
+	if err != nil {
+		return "", "", err
+	}
+	return key, value, nil
+}
+
+// unescapeProperty resolves the escape sequences of a .properties key or value.
+func unescapeProperty(s string) (string, error) {
+	if !strings.Contains(s, `\`) {
+		return s, nil
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i == len(s)-1 {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 't':
+			b.WriteByte('\t')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 'f':
+			b.WriteByte('\f')
+		case 'u':
+			if i+4 >= len(s) {
+				return "", fmt.Errorf("invalid unicode escape in %q", s)
+			}
+			r, err := strconv.ParseUint(s[i+1:i+5], 16, 32)
+			if err != nil {
+				return "", fmt.Errorf("invalid unicode escape in %q", s)
+			}
+			var buf [utf8.UTFMax]byte
+			n := utf8.EncodeRune(buf[:], rune(r))
+			b.Write(buf[:n])
+			i += 4
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String(), nil
+}
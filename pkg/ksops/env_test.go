@@ -0,0 +1,206 @@
+// Copyright 2026 viaduct.ai
+// SPDX-License-Identifier: Apache-2.0
+
+package ksops
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"sigs.k8s.io/yaml"
+)
+
+func TestEnvSourceUnmarshal(t *testing.T) {
+	var sf SecretGenerator
+	err := yaml.Unmarshal([]byte(`envs:
+- ./secret.enc.env
+- path: ./config.enc.yaml
+  format: json
+  separator: _
+`), &sf)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []EnvSource{
+		{Path: "./secret.enc.env"},
+		{Path: "./config.enc.yaml", Format: "json", Separator: "_"},
+	}
+	if !reflect.DeepEqual(sf.Envs, want) {
+		t.Errorf("envs = %+v, want %+v", sf.Envs, want)
+	}
+
+	if err := yaml.Unmarshal([]byte("envs:\n- [a, b]\n"), &sf); err == nil {
+		t.Error("expected error for a list envs entry")
+	}
+}
+
+func TestEnvFormat(t *testing.T) {
+	tests := []struct {
+		source  EnvSource
+		want    string
+		wantErr bool
+	}{
+		{source: EnvSource{Path: "secret.enc.env"}, want: "dotenv"},
+		{source: EnvSource{Path: "secret.env"}, want: "dotenv"},
+		{source: EnvSource{Path: "secret"}, want: "dotenv"},
+		{source: EnvSource{Path: "config.enc.yaml"}, want: "yaml"},
+		{source: EnvSource{Path: "config.enc.yml"}, want: "yaml"},
+		{source: EnvSource{Path: "config.enc.json"}, want: "json"},
+		{source: EnvSource{Path: "app.enc.ini"}, want: "ini"},
+		{source: EnvSource{Path: "app.enc.properties"}, want: "properties"},
+		{source: EnvSource{Path: "config.enc", Format: "YAML"}, want: "yaml"},
+		{source: EnvSource{Path: "config.enc.yaml", Format: "env"}, want: "dotenv"},
+		{source: EnvSource{Path: "config.enc", Format: "toml"}, wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.source.Path+"/"+tc.source.Format, func(t *testing.T) {
+			got, err := envFormat(tc.source)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("envFormat(%+v) = %q, want %q", tc.source, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseEnv(t *testing.T) {
+	tests := []struct {
+		name      string
+		data      string
+		format    string
+		separator string
+		want      map[string]string
+		wantErr   bool
+	}{
+		{
+			name:   "dotenv",
+			data:   "USER=admin\nPASSWORD=hunter2\n",
+			format: "dotenv",
+			want:   map[string]string{"USER": "admin", "PASSWORD": "hunter2"},
+		},
+		{
+			name:   "yaml nested",
+			data:   "db:\n  user: admin\n  port: 5432\nhosts:\n- a\n- b\nempty: null\n",
+			format: "yaml",
+			want:   map[string]string{"db.user": "admin", "db.port": "5432", "hosts.0": "a", "hosts.1": "b", "empty": ""},
+		},
+		{
+			name:      "json with separator",
+			data:      `{"db": {"user": "admin"}, "flag": true}`,
+			format:    "json",
+			separator: "__",
+			want:      map[string]string{"db__user": "admin", "flag": "true"},
+		},
+		{
+			name:   "ini sections",
+			data:   "top = 1\n[smtp]\nuser = mailer\n",
+			format: "ini",
+			want:   map[string]string{"top": "1", "smtp.user": "mailer"},
+		},
+		{
+			name:   "properties",
+			data:   "a=1\n",
+			format: "properties",
+			want:   map[string]string{"a": "1"},
+		},
+		{
+			name:    "yaml list",
+			data:    "- a\n- b\n",
+			format:  "yaml",
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseEnv([]byte(tc.data), tc.format, tc.separator)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("parseEnv() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseProperties(t *testing.T) {
+	data := `# comment
+! also a comment
+
+equals=1
+colon:2
+space 3
+  padded   =   4
+empty=
+escaped\=key=5
+multi=first \
+      second
+tab=a\tb
+unicode=caf\u00e9
+literal=back\\
+`
+	got, err := parseProperties([]byte(data))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := map[string]string{
+		"equals":      "1",
+		"colon":       "2",
+		"space":       "3",
+		"padded":      "4",
+		"empty":       "",
+		"escaped=key": "5",
+		"multi":       "first second",
+		"tab":         "a\tb",
+		"unicode":     "café",
+		"literal":     `back\`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseProperties() = %v, want %v", got, want)
+	}
+
+	if _, err := parseProperties([]byte(`bad=\u12`)); err == nil {
+		t.Error("expected error for a truncated unicode escape")
+	}
+}
+
+func TestGenerateSecretFromStructuredEnvs(t *testing.T) {
+	importTestKey(t)
+
+	dir := testFixturePath(t, "test", "krm", "structuredenvs")
+	manifest := makeManifest(nil, `secretFrom:
+- metadata:
+    name: mysecret
+  envs:
+  - path: `+dir+`/config.enc.yaml
+    separator: _
+  - `+dir+`/app.enc.properties`)
+
+	got, _, err := generate(context.Background(), manifest, "")
+	if err != nil {
+		t.Fatalf("generate failed: %v", err)
+	}
+	for _, want := range []string{"database_password: 1f2d1e2e67df", "hosts_1: b.internal", "jdbc.user: app"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output missing %q:\n%s", want, got)
+		}
+	}
+}
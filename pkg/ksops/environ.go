@@ -0,0 +1,112 @@
+// Copyright 2026 viaduct.ai
+// SPDX-License-Identifier: Apache-2.0
+
+package ksops
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OptionsFromEnv returns the options set by the KSOPS_* environment variables,
+// as the ksops binary applies them:
+//
+//   - KSOPS_CONCURRENCY_LIMIT, see WithConcurrency
+//   - KSOPS_AGGREGATE_ERRORS, see WithAggregateErrors
+//   - KSOPS_TIMEOUT and KSOPS_FILE_TIMEOUT, see WithTimeout and WithFileTimeout
+//   - KSOPS_RETRY_ATTEMPTS and KSOPS_RETRY_BASE_DELAY, see WithRetry
+//   - KSOPS_<PROVIDER>_CONCURRENCY_LIMIT and KSOPS_<PROVIDER>_RATE_LIMIT, such
+//     as KSOPS_KMS_RATE_LIMIT, see WithProviderLimit
+//   - KSOPS_LOAD_RESTRICTOR, see WithLoadRestrictor
+//   - KSOPS_TLS_EXPIRY_WARNING, see WithTLSExpiryWarning
+//
+// Unset variables add no option. A Generator created without these options is
+// not affected by the environment.
+func OptionsFromEnv() ([]Option, error) {
+	var opts []Option
+	if v := os.Getenv("KSOPS_CONCURRENCY_LIMIT"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid KSOPS_CONCURRENCY_LIMIT %q: must be a positive integer", v)
+		}
+		opts = append(opts, WithConcurrency(n))
+	}
+	if v := os.Getenv("KSOPS_AGGREGATE_ERRORS"); v != "" {
+		aggregate, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing KSOPS_AGGREGATE_ERRORS value %q: %w", v, err)
+		}
+		opts = append(opts, WithAggregateErrors(aggregate))
+	}
+	for _, timeout := range []struct {
+		env string
+		opt func(time.Duration) Option
+	}{
+		{"KSOPS_TIMEOUT", WithTimeout},
+		{"KSOPS_FILE_TIMEOUT", WithFileTimeout},
+	} {
+		if v := os.Getenv(timeout.env); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d < 0 {
+				return nil, fmt.Errorf("invalid %s %q: must be a non-negative duration such as 30s", timeout.env, v)
+			}
+			opts = append(opts, timeout.opt(d))
+		}
+	}
+
+	attempts, baseDelay := defaultRetryAttempts, defaultRetryBaseDelay
+	if v := os.Getenv("KSOPS_RETRY_ATTEMPTS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid KSOPS_RETRY_ATTEMPTS %q: must be a positive integer", v)
+		}
+		attempts = n
+	}
+	if v := os.Getenv("KSOPS_RETRY_BASE_DELAY"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid KSOPS_RETRY_BASE_DELAY %q: must be a non-negative duration such as 200ms", v)
+		}
+		baseDelay = d
+	}
+	if attempts != defaultRetryAttempts || baseDelay != defaultRetryBaseDelay {
+		opts = append(opts, WithRetry(attempts, baseDelay))
+	}
+
+	for _, provider := range keyProviderTypes {
+		prefix := "KSOPS_" + strings.ToUpper(provider)
+		var limit providerLimit
+		if v := os.Getenv(prefix + "_CONCURRENCY_LIMIT"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("invalid %s_CONCURRENCY_LIMIT %q: must be a positive integer", prefix, v)
+			}
+			limit.concurrency = n
+		}
+		if v := os.Getenv(prefix + "_RATE_LIMIT"); v != "" {
+			rps, err := strconv.ParseFloat(v, 64)
+			if err != nil || rps <= 0 {
+				return nil, fmt.Errorf("invalid %s_RATE_LIMIT %q: must be a positive number of decryptions per second", prefix, v)
+			}
+			limit.perSecond = rps
+		}
+		if limit != (providerLimit{}) {
+			opts = append(opts, WithProviderLimit(provider, limit.concurrency, limit.perSecond))
+		}
+	}
+
+	if v := os.Getenv("KSOPS_LOAD_RESTRICTOR"); v != "" {
+		opts = append(opts, WithLoadRestrictor(v))
+	}
+	if v := os.Getenv("KSOPS_TLS_EXPIRY_WARNING"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid KSOPS_TLS_EXPIRY_WARNING %q: must be a non-negative duration such as 720h", v)
+		}
+		opts = append(opts, WithTLSExpiryWarning(d))
+	}
+	return opts, nil
+}
@@ -0,0 +1,90 @@
+// Copyright 2026 viaduct.ai
+// SPDX-License-Identifier: Apache-2.0
+
+package ksops
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// ksopsEnv are the environment variables read by OptionsFromEnv.
+var ksopsEnv = []string{
+	"KSOPS_CONCURRENCY_LIMIT", "KSOPS_AGGREGATE_ERRORS", "KSOPS_TIMEOUT", "KSOPS_FILE_TIMEOUT",
+	"KSOPS_RETRY_ATTEMPTS", "KSOPS_RETRY_BASE_DELAY", "KSOPS_KMS_CONCURRENCY_LIMIT", "KSOPS_KMS_RATE_LIMIT",
+	"KSOPS_GCP_KMS_RATE_LIMIT", "KSOPS_LOAD_RESTRICTOR", "KSOPS_TLS_EXPIRY_WARNING",
+}
+
+func TestOptionsFromEnv(t *testing.T) {
+	for _, env := range ksopsEnv {
+		t.Setenv(env, "")
+	}
+
+	t.Run("unset", func(t *testing.T) {
+		opts, err := OptionsFromEnv()
+		if err != nil || len(opts) != 0 {
+			t.Errorf("OptionsFromEnv() = %d options, %v, want none", len(opts), err)
+		}
+	})
+
+	t.Run("set", func(t *testing.T) {
+		for env, value := range map[string]string{
+			"KSOPS_CONCURRENCY_LIMIT":     "5",
+			"KSOPS_AGGREGATE_ERRORS":      "true",
+			"KSOPS_TIMEOUT":               "1m",
+			"KSOPS_FILE_TIMEOUT":          "10s",
+			"KSOPS_RETRY_ATTEMPTS":        "4",
+			"KSOPS_RETRY_BASE_DELAY":      "1ms",
+			"KSOPS_KMS_CONCURRENCY_LIMIT": "2",
+			"KSOPS_KMS_RATE_LIMIT":        "5",
+			"KSOPS_GCP_KMS_RATE_LIMIT":    "0.5",
+			"KSOPS_LOAD_RESTRICTOR":       loadRestrictionsNone,
+			"KSOPS_TLS_EXPIRY_WARNING":    "48h",
+		} {
+			t.Setenv(env, value)
+		}
+		opts, err := OptionsFromEnv()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		g := New(opts...)
+		if g.concurrency != 5 || !g.aggregate || g.loadRestrictor != loadRestrictionsNone || g.tlsExpiryWarning != 48*time.Hour {
+			t.Errorf("unexpected generator: %+v", g)
+		}
+		if g.timeout == nil || *g.timeout != time.Minute || g.fileTimeout == nil || *g.fileTimeout != 10*time.Second {
+			t.Errorf("unexpected timeouts: %v, %v", g.timeout, g.fileTimeout)
+		}
+		if g.retry.attempts != 4 || g.retry.baseDelay != time.Millisecond {
+			t.Errorf("unexpected retry policy: %+v", g.retry)
+		}
+		if got := g.providerLimits["kms"]; got != (providerLimit{concurrency: 2, perSecond: 5}) {
+			t.Errorf("unexpected kms limit: %+v", got)
+		}
+		if got := g.providerLimits["gcp_kms"]; got != (providerLimit{perSecond: 0.5}) {
+			t.Errorf("unexpected gcp_kms limit: %+v", got)
+		}
+	})
+
+	for env, value := range map[string]string{
+		"KSOPS_CONCURRENCY_LIMIT":     "abc",
+		"KSOPS_AGGREGATE_ERRORS":      "sometimes",
+		"KSOPS_TIMEOUT":               "soon",
+		"KSOPS_FILE_TIMEOUT":          "-1s",
+		"KSOPS_RETRY_ATTEMPTS":        "0",
+		"KSOPS_RETRY_BASE_DELAY":      "later",
+		"KSOPS_KMS_CONCURRENCY_LIMIT": "0",
+		"KSOPS_GCP_KMS_RATE_LIMIT":    "-1",
+		"KSOPS_TLS_EXPIRY_WARNING":    "30d",
+	} {
+		t.Run("invalid "+env, func(t *testing.T) {
+			for _, env := range ksopsEnv {
+				t.Setenv(env, "")
+			}
+			t.Setenv(env, value)
+			if _, err := OptionsFromEnv(); err == nil || !strings.Contains(err.Error(), env) {
+				t.Errorf("expected error mentioning %s, got %v", env, err)
+			}
+		})
+	}
+}
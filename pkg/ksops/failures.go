@@ -0,0 +1,103 @@
+// Copyright 2026 viaduct.ai
+// SPDX-License-Identifier: Apache-2.0
+
+package ksops
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+
+	"github.com/getsops/sops/v3"
+)
+
+// failureClass groups decryption failures by their cause.
+type failureClass string
+
+// Failure classes, in the order they are reported.
+const (
+	failureMissingFile failureClass = "missing file"
+	failureNoUsableKey failureClass = "no usable key"
+	failureMACMismatch failureClass = "MAC mismatch"
+	failureParseError  failureClass = "parse error"
+	failureOther       failureClass = "other"
+)
+
+var failureClasses = []failureClass{
+	failureMissingFile,
+	failureNoUsableKey,
+	failureMACMismatch,
+	failureParseError,
+	failureOther,
+}
+
+// classifyFailure returns the class of a decryption failure. SOPS does not
+// export most of its errors, so some are matched on their message.
+func classifyFailure(err error) failureClass {
+	var userErr interface{ UserError() string }
+	msg := err.Error()
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return failureMissingFile
+	case errors.As(err, &userErr), strings.Contains(msg, "Error getting data key"):
+		return failureNoUsableKey
+	case strings.Contains(msg, "Failed to verify data integrity"), strings.Contains(msg, "Failed to decrypt original mac"):
+		return failureMACMismatch
+	case errors.Is(err, sops.MetadataNotFound), strings.Contains(msg, "Error unmarshal"), strings.Contains(msg, "error unmarshalling"), strings.Contains(msg, "error parsing"):
+		return failureParseError
+	}
+	return failureOther
+}
+
+// decryptionErrors are the failures of decryptions that were all attempted.
+type decryptionErrors []error
+
+// newDecryptionErrors combines the non-nil errors, flattening nested
+// decryptionErrors. It returns nil without errors, and a single error as is.
+func newDecryptionErrors(errs ...error) error {
+	var combined decryptionErrors
+	for _, err := range errs {
+		var nested decryptionErrors
+		switch {
+		case err == nil:
+		case errors.As(err, &nested):
+			combined = append(combined, nested...)
+		default:
+			combined = append(combined, err)
+		}
+	}
+	switch len(combined) {
+	case 0:
+		return nil
+	case 1:
+		return combined[0]
+	}
+	return combined
+}
+
+// Error lists every failure, grouped by class.
+func (e decryptionErrors) Error() string {
+	byClass := make(map[failureClass][]error)
+	for _, err := range e {
+		class := classifyFailure(err)
+		byClass[class] = append(byClass[class], err)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d decryptions failed:", len(e))
+	for _, class := range failureClasses {
+		if len(byClass[class]) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "\n%s (%d):", class, len(byClass[class]))
+		for _, err := range byClass[class] {
+			fmt.Fprintf(&b, "\n  - %s", err)
+		}
+	}
+	return b.String()
+}
+
+func (e decryptionErrors) Unwrap() []error {
+	return e
+}
@@ -0,0 +1,161 @@
+// Copyright 2026 viaduct.ai
+// SPDX-License-Identifier: Apache-2.0
+
+package ksops
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// keyError mimics the unexported error SOPS returns when no key group can be decrypted.
+type keyError struct{}
+
+func (keyError) Error() string     { return "Error getting data key: 1 successful groups required, got 0" }
+func (keyError) UserError() string { return "no key could decrypt the data key" }
+
+// failingFiles writes a file for each decryption failure class to a temporary
+// directory and returns their paths: missing, tampered and plain.
+func failingFiles(t *testing.T) (string, string, string) {
+	t.Helper()
+	dir := t.TempDir()
+
+	encrypted, err := os.ReadFile(testFixturePath(t, "test", "legacy", "single", "secret.enc.yaml"))
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+	tampered := filepath.Join(dir, "tampered.enc.yaml")
+	if err := os.WriteFile(tampered, []byte(strings.Replace(string(encrypted), "name: mysecret", "name: tampered", 1)), 0o644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	plain := filepath.Join(dir, "plain.yaml")
+	if err := os.WriteFile(plain, []byte("apiVersion: v1\nkind: Secret\nmetadata:\n  name: plain\n"), 0o644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	return filepath.Join(dir, "missing.enc.yaml"), tampered, plain
+}
+
+func TestClassifyFailure(t *testing.T) {
+	importTestKey(t)
+	missing, tampered, plain := failingFiles(t)
+
+	for _, tc := range []struct {
+		file string
+		want failureClass
+	}{
+		{file: missing, want: failureMissingFile},
+		{file: tampered, want: failureMACMismatch},
+		{file: plain, want: failureParseError},
+	} {
+		t.Run(string(tc.want), func(t *testing.T) {
+			p := newDecryptPlan()
+			p.add(tc.file, fileRef{field: "files[0]"})
+			err := p.decrypt(newTestDecryptGroup(t))
+			if err == nil {
+				t.Fatal("expected decryption to fail")
+			}
+			if got := classifyFailure(err); got != tc.want {
+				t.Errorf("classifyFailure(%v) = %q, want %q", err, got, tc.want)
+			}
+		})
+	}
+
+	if got := classifyFailure(newFieldError("files[0]", "", keyError{})); got != failureNoUsableKey {
+		t.Errorf("classifyFailure(keyError) = %q, want %q", got, failureNoUsableKey)
+	}
+	if got := classifyFailure(errors.New("unexpected")); got != failureOther {
+		t.Errorf("classifyFailure(unexpected) = %q, want %q", got, failureOther)
+	}
+}
+
+func TestNewDecryptionErrors(t *testing.T) {
+	if err := newDecryptionErrors(nil, nil); err != nil {
+		t.Errorf("expected nil without errors, got %v", err)
+	}
+
+	single := errors.New("single")
+	if err := newDecryptionErrors(nil, single); err != single {
+		t.Errorf("expected a single error as is, got %v", err)
+	}
+
+	a, b, c := errors.New("a"), errors.New("b"), errors.New("c")
+	err := newDecryptionErrors(newDecryptionErrors(a, b), nil, c)
+	var combined decryptionErrors
+	if !errors.As(err, &combined) || len(combined) != 3 {
+		t.Fatalf("expected 3 flattened errors, got %v", err)
+	}
+	for _, e := range []error{a, b, c} {
+		if !errors.Is(err, e) {
+			t.Errorf("combined error should wrap %v", e)
+		}
+	}
+}
+
+func TestDecryptAllAggregate(t *testing.T) {
+	g := newTestDecryptGroup(t)
+	g.aggregate = true
+
+	var attempted atomic.Int32
+	_, err := decryptAll(g, []string{"a", "b", "c"}, nil, func(_ context.Context, file string) (string, error) {
+		attempted.Add(1)
+		return "", errors.New(file + " failed")
+	})
+	var combined decryptionErrors
+	if !errors.As(err, &combined) || len(combined) != 3 {
+		t.Fatalf("expected every failure, got %v", err)
+	}
+	if n := attempted.Load(); n != 3 {
+		t.Errorf("expected every item to be attempted, got %d", n)
+	}
+}
+
+func TestGenerateAggregateErrors(t *testing.T) {
+	importTestKey(t)
+	missing, tampered, plain := failingFiles(t)
+	valid := testFixturePath(t, "test", "legacy", "single", "secret.enc.yaml")
+	manifest := makeManifest([]string{valid, missing}, fmt.Sprintf(`secretFrom:
+- metadata:
+    name: mysecret
+  files:
+  - %s
+  envs:
+  - %s`, tampered, plain))
+
+	t.Run("first failure by default", func(t *testing.T) {
+		_, _, err := generate(context.Background(), manifest, "", WithLoadRestrictor(loadRestrictionsNone))
+		if err == nil {
+			t.Fatal("expected error")
+		}
+		var combined decryptionErrors
+		if errors.As(err, &combined) {
+			t.Errorf("expected a single failure, got %v", err)
+		}
+	})
+
+	t.Run("aggregated", func(t *testing.T) {
+		_, _, err := generate(context.Background(), manifest, "", WithLoadRestrictor(loadRestrictionsNone), WithAggregateErrors(true))
+		var combined decryptionErrors
+		if !errors.As(err, &combined) || len(combined) != 3 {
+			t.Fatalf("expected 3 failures, got %v", err)
+		}
+		msg := err.Error()
+		for _, want := range []string{
+			"missing file (1):", missing,
+			"MAC mismatch (1):", tampered,
+			"parse error (1):", plain,
+		} {
+			if !strings.Contains(msg, want) {
+				t.Errorf("error should contain %q:\n%s", want, msg)
+			}
+		}
+		if strings.Contains(msg, valid) {
+			t.Errorf("error should not list the valid file:\n%s", msg)
+		}
+	})
+}
@@ -0,0 +1,102 @@
+// Copyright 2026 viaduct.ai
+// SPDX-License-Identifier: Apache-2.0
+
+package ksops
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/getsops/sops/v3"
+	"github.com/getsops/sops/v3/cmd/sops/common"
+	"github.com/getsops/sops/v3/cmd/sops/formats"
+	"github.com/getsops/sops/v3/config"
+)
+
+// FileSource is an entry of files or binaryFiles. It is either a plain path, or
+// an object that also sets the SOPS format of the encrypted file. In secretFrom
+// and configMapFrom, the path is a key=path#selector entry.
+type FileSource struct {
+	Path string `json:"path" yaml:"path"`
+	// Format is yaml, json, dotenv, ini or binary. By default, it is the format
+	// of the file extension or, for unknown extensions, of the sops metadata
+	// found in the content.
+	Format string `json:"format,omitempty" yaml:"format,omitempty"`
+}
+
+// UnmarshalJSON accepts either a plain path or an object.
+func (f *FileSource) UnmarshalJSON(b []byte) error {
+	var path string
+	if err := json.Unmarshal(b, &path); err == nil {
+		*f = FileSource{Path: path}
+		return nil
+	}
+
+	type plain FileSource
+	var p plain
+	if err := json.Unmarshal(b, &p); err != nil {
+		return fmt.Errorf("files entries must be a path or an object with a path: %w", err)
+	}
+	*f = FileSource(p)
+	return nil
+}
+
+// parseFormat validates the SOPS format set for a file, returning its
+// canonical name, or "" if it is not set.
+func parseFormat(format string) (string, error) {
+	switch f := strings.ToLower(format); f {
+	case "":
+		return "", nil
+	case "yml":
+		return "yaml", nil
+	case "env":
+		return "dotenv", nil
+	case "yaml", "json", "dotenv", "ini", "binary":
+		return f, nil
+	default:
+		return "", fmt.Errorf("unsupported format %q: must be one of yaml, json, dotenv, ini or binary", format)
+	}
+}
+
+// sopsFormat returns the SOPS format of an encrypted file: format, the format
+// set in the manifest, if any, or else the format of its extension or, for
+// unknown extensions, of its content.
+func sopsFormat(file, format string, data []byte) formats.Format {
+	if format != "" {
+		return formats.FormatFromString(format)
+	}
+	if hasFormatExtension(file) {
+		return formats.FormatForPath(file)
+	}
+	return sniffFormat(data)
+}
+
+// hasFormatExtension reports whether file has the extension of a SOPS format
+// other than binary.
+func hasFormatExtension(file string) bool {
+	return formats.IsYAMLFile(file) || formats.IsJSONFile(file) || formats.IsEnvFile(file) || formats.IsIniFile(file)
+}
+
+// sniffFormat returns the format of the sops metadata found in data. JSON with
+// only a data key is the binary format, which SOPS stores as JSON. Content
+// without sops metadata is binary, as SOPS assumes for unknown extensions.
+func sniffFormat(data []byte) formats.Format {
+	for _, format := range []formats.Format{formats.Json, formats.Yaml, formats.Dotenv, formats.Ini} {
+		tree, err := common.StoreForFormat(format, config.NewStoresConfig()).LoadEncryptedFile(data)
+		if err != nil {
+			continue
+		}
+		if format == formats.Json && isBinaryTree(tree) {
+			return formats.Binary
+		}
+		return format
+	}
+	return formats.Binary
+}
+
+// isBinaryTree reports whether an encrypted JSON tree holds a single data key,
+// as SOPS encrypts binary files.
+func isBinaryTree(tree sops.Tree) bool {
+	return len(tree.Branches) == 1 && len(tree.Branches[0]) == 1 && tree.Branches[0][0].Key == "data"
+}
@@ -0,0 +1,149 @@
+// Copyright 2026 viaduct.ai
+// SPDX-License-Identifier: Apache-2.0
+
+package ksops
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/getsops/sops/v3/cmd/sops/formats"
+)
+
+func TestParseFormat(t *testing.T) {
+	for format, want := range map[string]string{
+		"":       "",
+		"yaml":   "yaml",
+		"YML":    "yaml",
+		"json":   "json",
+		"env":    "dotenv",
+		"dotenv": "dotenv",
+		"ini":    "ini",
+		"binary": "binary",
+	} {
+		got, err := parseFormat(format)
+		if err != nil || got != want {
+			t.Errorf("parseFormat(%q) = %q, %v, want %q", format, got, err, want)
+		}
+	}
+	if _, err := parseFormat("toml"); err == nil {
+		t.Error("expected an error for an unsupported format")
+	}
+}
+
+func TestSniffFormat(t *testing.T) {
+	for fixture, want := range map[string]formats.Format{
+		"test/krm/single/secret.enc.yaml":   formats.Yaml,
+		"test/krm/selector/config.enc.json": formats.Json,
+		"test/krm/selector/app.enc.ini":     formats.Ini,
+		"test/krm/envs/secret.enc.env":      formats.Dotenv,
+		"test/krm/tls/tls.enc.crt":          formats.Binary,
+	} {
+		data, err := os.ReadFile(fixture)
+		if err != nil {
+			t.Fatalf("failed to read fixture: %v", err)
+		}
+		if got := sniffFormat(data); got != want {
+			t.Errorf("sniffFormat(%s) = %v, want %v", fixture, got, want)
+		}
+	}
+	if got := sniffFormat([]byte("password: hunter2\n")); got != formats.Binary {
+		t.Errorf("expected content without sops metadata to be binary, got %v", got)
+	}
+}
+
+func TestSopsFormat(t *testing.T) {
+	yamlData, err := os.ReadFile("test/krm/single/secret.enc.yaml")
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+	tests := []struct {
+		file, format string
+		want         formats.Format
+	}{
+		{file: "secret.enc", format: "", want: formats.Yaml},
+		{file: "secret.json", format: "", want: formats.Json},
+		{file: "secret.enc", format: "binary", want: formats.Binary},
+		{file: "secret.txt", format: "dotenv", want: formats.Dotenv},
+	}
+	for _, tc := range tests {
+		if got := sopsFormat(tc.file, tc.format, yamlData); got != tc.want {
+			t.Errorf("sopsFormat(%q, %q) = %v, want %v", tc.file, tc.format, got, tc.want)
+		}
+	}
+}
+
+func TestGenerateFormats(t *testing.T) {
+	importTestKey(t)
+	dir := t.TempDir()
+	for src, dst := range map[string]string{
+		"test/krm/single/secret.enc.yaml":    "secret.enc",
+		"test/krm/selector/secrets.enc.yaml": "secrets.txt",
+	} {
+		data, err := os.ReadFile(src)
+		if err != nil {
+			t.Fatalf("failed to read fixture: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, dst), data, 0o600); err != nil {
+			t.Fatalf("failed to write %s: %v", dst, err)
+		}
+	}
+
+	manifest := []byte(`apiVersion: viaduct.ai/v1
+kind: ksops
+metadata:
+  name: test
+files:
+  - secret.enc
+secretFrom:
+  - metadata:
+      name: formats
+    files:
+      - path: password=secrets.txt#.database.password
+        format: yaml
+    envs:
+      - path: secrets.txt
+        format: yaml
+        sopsFormat: yaml
+`)
+	objs, _, err := New(WithRoot(dir)).generate(context.Background(), manifest, "")
+	if err != nil {
+		t.Fatalf("generate failed: %v", err)
+	}
+	if len(objs) != 2 {
+		t.Fatalf("expected 2 objects, got %d:\n%s", len(objs), objs)
+	}
+	if name := objs[0].GetName(); name != "mysecret" {
+		t.Errorf("expected the sniffed YAML file to be decrypted, got %q", name)
+	}
+	if got, _, _ := objs[1].NestedString("stringData", "password"); got == "" || strings.HasPrefix(got, "ENC[") {
+		t.Errorf("expected the selected value to be decrypted, got %q:\n%s", got, objs[1])
+	}
+	if got, _, _ := objs[1].NestedString("stringData", "database.password"); got == "" || strings.HasPrefix(got, "ENC[") {
+		t.Errorf("expected the env file to be decrypted, got %q:\n%s", got, objs[1])
+	}
+
+	// The SOPS format of envs is set apart from the format they are parsed as.
+	wrong := []byte("apiVersion: viaduct.ai/v1\nkind: ksops\nmetadata:\n  name: test\nsecretFrom:\n  - metadata:\n      name: env\n    envs:\n      - path: secrets.txt\n        format: yaml\n        sopsFormat: json\n")
+	if _, _, err := New(WithRoot(dir)).generate(context.Background(), wrong, ""); err == nil || !strings.Contains(err.Error(), "trouble decrypting file") {
+		t.Errorf("expected the env file to be decrypted as json, got %v", err)
+	}
+
+	conflict := []byte("apiVersion: viaduct.ai/v1\nkind: ksops\nmetadata:\n  name: test\nfiles:\n  - path: secret.enc\n    format: yaml\nsecretFrom:\n  - metadata:\n      name: env\n    envs:\n      - path: secret.enc\n        sopsFormat: json\n")
+	_, _, err = New(WithRoot(dir)).generate(context.Background(), conflict, "")
+	var conflictErr *fieldError
+	if !errors.As(err, &conflictErr) || conflictErr.field != "secretFrom[0].envs[0]" {
+		t.Errorf("expected a format conflict at secretFrom[0].envs[0], got %v", err)
+	}
+
+	invalid := []byte("apiVersion: viaduct.ai/v1\nkind: ksops\nmetadata:\n  name: test\nfiles:\n  - path: secret.enc\n    format: toml\n")
+	_, _, err = New(WithRoot(dir)).generate(context.Background(), invalid, "")
+	var fe *fieldError
+	if !errors.As(err, &fe) || fe.field != "files[0].format" {
+		t.Errorf("expected an unsupported format error at files[0].format, got %v", err)
+	}
+}
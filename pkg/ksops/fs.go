@@ -0,0 +1,68 @@
+// Copyright 2026 viaduct.ai
+// SPDX-License-Identifier: Apache-2.0
+
+package ksops
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// osFS is the filesystem of the operating system. Unlike os.DirFS, it takes
+// native paths, absolute or relative to the working directory, as the
+// manifests of the ksops binary do.
+type osFS struct{}
+
+func (osFS) Open(name string) (fs.File, error)          { return os.Open(name) }
+func (osFS) Stat(name string) (fs.FileInfo, error)      { return os.Stat(name) }
+func (osFS) ReadFile(name string) ([]byte, error)       { return os.ReadFile(name) }
+func (osFS) ReadDir(name string) ([]fs.DirEntry, error) { return os.ReadDir(name) }
+func (osFS) Glob(pattern string) ([]string, error)      { return filepath.Glob(pattern) }
+
+// pathFS adapts an fs.FS to the native paths ksops resolves: paths are cleaned
+// and slash separated before being passed to the fs.FS, and glob matches are
+// converted back. Paths outside the fs.FS, such as absolute paths, are invalid.
+type pathFS struct {
+	fsys fs.FS
+}
+
+// name returns the fs.FS name of a native path.
+func (f pathFS) name(file string) string {
+	return path.Clean(filepath.ToSlash(file))
+}
+
+func (f pathFS) Open(name string) (fs.File, error) {
+	return f.fsys.Open(f.name(name))
+}
+
+func (f pathFS) Stat(name string) (fs.FileInfo, error) {
+	return fs.Stat(f.fsys, f.name(name))
+}
+
+func (f pathFS) ReadFile(name string) ([]byte, error) {
+	return fs.ReadFile(f.fsys, f.name(name))
+}
+
+func (f pathFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return fs.ReadDir(f.fsys, f.name(name))
+}
+
+func (f pathFS) Glob(pattern string) ([]string, error) {
+	matches, err := fs.Glob(f.fsys, f.name(pattern))
+	if err != nil {
+		return nil, err
+	}
+	for i, match := range matches {
+		matches[i] = filepath.FromSlash(match)
+	}
+	return matches, nil
+}
+
+// isOS reports whether fsys is the filesystem of the operating system, which
+// has a working directory and symlinks.
+func isOS(fsys fs.FS) bool {
+	_, ok := fsys.(osFS)
+	return ok
+}
@@ -0,0 +1,59 @@
+// Copyright 2026 viaduct.ai
+// SPDX-License-Identifier: Apache-2.0
+
+package ksops
+
+import (
+	"io/fs"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestPathFS(t *testing.T) {
+	fsys := pathFS{fsys: fstest.MapFS{
+		"dir/a.yaml": {Data: []byte("a")},
+		"dir/b.yaml": {Data: []byte("b")},
+	}}
+
+	if data, err := fs.ReadFile(fsys, filepath.Join("dir", "sub", "..", "a.yaml")); err != nil || string(data) != "a" {
+		t.Errorf("expected the path to be cleaned, got %q, %v", data, err)
+	}
+	matches, err := fs.Glob(fsys, filepath.Join("dir", "*.yaml"))
+	if err != nil {
+		t.Fatalf("Glob failed: %v", err)
+	}
+	if want := []string{filepath.Join("dir", "a.yaml"), filepath.Join("dir", "b.yaml")}; !reflect.DeepEqual(matches, want) {
+		t.Errorf("Glob = %q, want %q", matches, want)
+	}
+	if _, err := fs.Stat(fsys, "/dir/a.yaml"); err == nil {
+		t.Error("expected an absolute path to be invalid")
+	}
+}
+
+func TestFileLoaderFS(t *testing.T) {
+	fsys := pathFS{fsys: fstest.MapFS{
+		"base/secret.yaml":    {Data: []byte("base")},
+		"overlay/secret.yaml": {Data: []byte("overlay")},
+	}}
+
+	l, err := newFileLoader(fsys, "overlay", "", "")
+	if err != nil {
+		t.Fatalf("newFileLoader failed: %v", err)
+	}
+	if got, err := l.expandPath("secret.yaml"); err != nil || !reflect.DeepEqual(got, []string{filepath.Join("overlay", "secret.yaml")}) {
+		t.Errorf("expected the path to resolve against the root, got %q, %v", got, err)
+	}
+	if _, err := l.expandPath(filepath.Join("..", "base", "secret.yaml")); err == nil {
+		t.Error("expected a file outside of the root to be rejected")
+	}
+
+	none, err := newFileLoader(fsys, "overlay", "", loadRestrictionsNone)
+	if err != nil {
+		t.Fatalf("newFileLoader failed: %v", err)
+	}
+	if _, err := none.expandPath(filepath.Join("..", "base", "secret.yaml")); err != nil {
+		t.Errorf("expected files outside of the root to be allowed: %v", err)
+	}
+}
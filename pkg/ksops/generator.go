@@ -0,0 +1,234 @@
+// Copyright 2026 viaduct.ai
+// SPDX-License-Identifier: Apache-2.0
+
+// Package ksops decrypts SOPS encrypted Kubernetes resources, and generates
+// Secrets and ConfigMaps from SOPS encrypted files, as the ksops kustomize
+// plugin does. A Generator runs ksops specs, or processes a ResourceList as a
+// KRM function.
+package ksops
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path/filepath"
+	"time"
+
+	"github.com/GoogleContainerTools/kpt-functions-sdk/go/fn"
+)
+
+// defaultConcurrencyLimit is the default number of concurrent decryptions.
+const defaultConcurrencyLimit = 20
+
+// Generator decrypts SOPS encrypted files and builds the resources of ksops
+// specs. Create one with New; it is safe for concurrent use.
+//
+// A Generator is only configured by its options, which take precedence over
+// the settings of the specs it runs. The ksops binary sets them from the
+// KSOPS_* environment variables, see OptionsFromEnv.
+type Generator struct {
+	concurrency int
+	root        string
+	fsys        fs.FS
+	decryptor   Decryptor
+	logger      *slog.Logger
+	// timeout and fileTimeout override those of the spec, if not nil.
+	timeout, fileTimeout *time.Duration
+	retry                retryPolicy
+	aggregate            bool
+	// loadRestrictor overrides the one of the spec, if set.
+	loadRestrictor   string
+	providerLimits   map[string]providerLimit
+	tlsExpiryWarning time.Duration
+}
+
+// Option configures a Generator.
+type Option func(*Generator)
+
+// WithConcurrency limits the number of concurrent decryptions, 20 by default.
+func WithConcurrency(n int) Option {
+	return func(g *Generator) {
+		g.concurrency = n
+	}
+}
+
+// WithRoot sets the kustomization root, the working directory, or the root of
+// the filesystem set with WithFS, by default. Relative paths are resolved
+// against it and, unless the load restrictor is disabled, files must be within
+// it.
+func WithRoot(dir string) Option {
+	return func(g *Generator) {
+		g.root = dir
+	}
+}
+
+// WithFS sets the filesystem manifests and encrypted files are read from, the
+// filesystem of the operating system by default. Paths are then relative to
+// fsys, the root included, and files cannot be outside of it.
+func WithFS(fsys fs.FS) Option {
+	return func(g *Generator) {
+		g.fsys = pathFS{fsys: fsys}
+	}
+}
+
+// WithDecryptor sets the Decryptor of the encrypted content, SOPS by default.
+func WithDecryptor(d Decryptor) Option {
+	return func(g *Generator) {
+		g.decryptor = d
+	}
+}
+
+// WithLogger sets the logger of retried decryptions, and of each decrypted
+// file at debug level. Nothing is logged by default.
+func WithLogger(l *slog.Logger) Option {
+	return func(g *Generator) {
+		g.logger = l
+	}
+}
+
+// WithTimeout limits the decryption of a whole spec, overriding its timeout.
+// A timeout of 0 disables it.
+func WithTimeout(d time.Duration) Option {
+	return func(g *Generator) {
+		g.timeout = &d
+	}
+}
+
+// WithFileTimeout limits the decryption of each file, overriding the
+// fileTimeout of the spec. A timeout of 0 disables it.
+func WithFileTimeout(d time.Duration) Option {
+	return func(g *Generator) {
+		g.fileTimeout = &d
+	}
+}
+
+// WithRetry sets the maximum number of attempts to decrypt a file after
+// transient key provider errors, 3 by default, and the delay before the first
+// retry, 200ms by default, which doubles on each retry. 1 attempt disables
+// retries.
+func WithRetry(attempts int, baseDelay time.Duration) Option {
+	return func(g *Generator) {
+		g.retry.attempts, g.retry.baseDelay = attempts, baseDelay
+	}
+}
+
+// WithAggregateErrors makes decryption continue after a failure, so that every
+// failure is reported at once, rather than stopping at the first one.
+func WithAggregateErrors(aggregate bool) Option {
+	return func(g *Generator) {
+		g.aggregate = aggregate
+	}
+}
+
+// WithLoadRestrictor sets the load restrictor, LoadRestrictionsRootOnly or
+// LoadRestrictionsNone, overriding the loadRestrictor of the spec. Without it,
+// a spec setting LoadRestrictionsNone is rejected.
+func WithLoadRestrictor(restrictor string) Option {
+	return func(g *Generator) {
+		g.loadRestrictor = restrictor
+	}
+}
+
+// WithProviderLimit limits the decryptions of files encrypted with a key
+// provider, such as kms or age, to concurrency concurrent decryptions and
+// perSecond decryptions per second. 0 leaves either unlimited.
+func WithProviderLimit(provider string, concurrency int, perSecond float64) Option {
+	return func(g *Generator) {
+		if g.providerLimits == nil {
+			g.providerLimits = make(map[string]providerLimit)
+		}
+		g.providerLimits[provider] = providerLimit{concurrency: concurrency, perSecond: perSecond}
+	}
+}
+
+// WithTLSExpiryWarning sets how long before the certificate of a
+// kubernetes.io/tls Secret expires to warn about it, 30 days by default. 0
+// disables the warning.
+func WithTLSExpiryWarning(d time.Duration) Option {
+	return func(g *Generator) {
+		g.tlsExpiryWarning = d
+	}
+}
+
+// New returns a Generator configured by opts.
+func New(opts ...Option) *Generator {
+	g := &Generator{
+		concurrency:      defaultConcurrencyLimit,
+		fsys:             osFS{},
+		decryptor:        sopsDecryptor{},
+		logger:           slog.New(slog.DiscardHandler),
+		retry:            retryPolicy{attempts: defaultRetryAttempts, baseDelay: defaultRetryBaseDelay},
+		tlsExpiryWarning: defaultTLSExpiryWarning,
+	}
+	for _, opt := range opts {
+		opt(g)
+	}
+	return g
+}
+
+// Generate decrypts the files of spec and builds its Secrets and ConfigMaps,
+// along with the resources of its files. Relative paths are resolved against
+// the root of the Generator. The returned results hold warnings.
+//
+// The EncryptedLiterals of a secretFrom entry are decrypted as they are, so
+// they must hold the YAML output of SOPS, with its keys in the order they were
+// encrypted in.
+func (ks *Generator) Generate(ctx context.Context, spec *Spec) (fn.KubeObjects, fn.Results, error) {
+	if !spec.generates() {
+		return nil, nil, errors.New("missing the required 'files', 'secretFrom' or 'configMapFrom' key in the ksops spec")
+	}
+	gen := &expandedManifest{manifest: *spec}
+	if err := gen.expand(ks.fsys, ks.root, "", ks.loadRestrictor); err != nil {
+		return nil, nil, err
+	}
+	return ks.run(ctx, gen)
+}
+
+// GenerateFile is Generate for the ksops manifest at path, relative to the
+// root of the Generator. Relative paths in the manifest are resolved against
+// its directory if it is within the root, and otherwise against the root, as
+// kustomize passes legacy plugins a temporary copy of their manifest.
+func (ks *Generator) GenerateFile(ctx context.Context, path string) (fn.KubeObjects, fn.Results, error) {
+	file := path
+	if ks.root != "" && !filepath.IsAbs(file) {
+		file = filepath.Join(ks.root, file)
+	}
+	raw, err := fs.ReadFile(ks.fsys, file)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to read in manifest: %w", err)
+	}
+	return ks.generate(ctx, raw, manifestDirWithin(ks.fsys, ks.root, path))
+}
+
+// generate decrypts the files and builds the secrets and config maps of a ksops
+// manifest. Relative paths are resolved against dir, the manifest's directory
+// relative to the root of the Generator. Errors about a field of the manifest
+// are fieldErrors, and the returned results hold warnings.
+func (ks *Generator) generate(ctx context.Context, raw []byte, dir string) (fn.KubeObjects, fn.Results, error) {
+	gen, err := expandManifest(raw, ks.fsys, ks.root, dir, ks.loadRestrictor)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ks.run(ctx, gen)
+}
+
+// run decrypts every file referenced by an expanded manifest once, in a single
+// pass, and then builds its output.
+func (ks *Generator) run(ctx context.Context, gen *expandedManifest) (fn.KubeObjects, fn.Results, error) {
+	g, err := ks.newDecryptGroup(ctx, gen.manifest.Timeout, gen.manifest.FileTimeout)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer g.stop()
+
+	p := newDecryptPlan()
+	if err := gen.plan(p); err != nil {
+		return nil, nil, err
+	}
+	if err := p.decrypt(g); err != nil {
+		return nil, nil, err
+	}
+	return gen.build(g, p)
+}
@@ -0,0 +1,256 @@
+// Copyright 2026 viaduct.ai
+// SPDX-License-Identifier: Apache-2.0
+
+package ksops_test
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/GoogleContainerTools/kpt-functions-sdk/go/fn"
+	"github.com/getsops/sops/v3/cmd/sops/formats"
+	"github.com/viaduct-ai/kustomize-sops/pkg/ksops"
+	"github.com/viaduct-ai/kustomize-sops/pkg/ksops/ksopstest"
+	"sigs.k8s.io/kustomize/api/types"
+)
+
+// writeFile writes content to name in dir and returns its path.
+func writeFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("failed to write %s: %v", path, err)
+	}
+	return path
+}
+
+const plainSecret = `apiVersion: v1
+kind: Secret
+metadata:
+  name: plain
+stringData:
+  password: hunter2
+`
+
+func TestGeneratorGenerate(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "secret.yaml", plainSecret)
+	writeFile(t, dir, "password.txt", "hunter2")
+
+	var calls atomic.Int32
+	d := ksops.DecryptorFunc(func(ctx context.Context, data []byte, format formats.Format) ([]byte, error) {
+		calls.Add(1)
+		return ksopstest.Decryptor{}.Decrypt(ctx, data, format)
+	})
+	objs, _, err := ksops.New(ksops.WithRoot(dir), ksops.WithDecryptor(d)).Generate(context.Background(), &ksops.Spec{
+		Files: []ksops.FileSource{{Path: "secret.yaml"}},
+		SecretFrom: []ksops.SecretGenerator{{
+			Files:    []ksops.FileSource{{Path: "password.txt"}},
+			Metadata: types.ObjectMeta{Name: "generated"},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if len(objs) != 2 || objs[0].GetName() != "plain" || objs[1].GetName() != "generated" {
+		t.Fatalf("unexpected objects:\n%s", objs)
+	}
+	if got, _, _ := objs[1].NestedString("stringData", "password.txt"); got != "hunter2" {
+		t.Errorf("expected the generated secret to hold the file, got %q:\n%s", got, objs[1])
+	}
+	if got := calls.Load(); got != 2 {
+		t.Errorf("expected 2 decryptions, got %d", got)
+	}
+}
+
+func TestGeneratorGenerateErrors(t *testing.T) {
+	g := ksops.New(ksops.WithDecryptor(ksopstest.Decryptor{}))
+
+	if _, _, err := g.Generate(context.Background(), &ksops.Spec{}); err == nil || !strings.Contains(err.Error(), "missing the required") {
+		t.Errorf("expected an error for an empty spec, got %v", err)
+	}
+}
+
+func TestGeneratorWithRoot(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	writeFile(t, outside, "secret.yaml", plainSecret)
+	if err := os.Mkdir(filepath.Join(root, "overlay"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, root, "overlay/secret.yaml", plainSecret)
+	writeFile(t, root, "overlay/generator.yaml", "apiVersion: viaduct.ai/v1\nkind: ksops\nmetadata:\n  name: test\nfiles:\n  - secret.yaml\n")
+
+	g := ksops.New(ksops.WithRoot(root), ksops.WithDecryptor(ksopstest.Decryptor{}))
+
+	// Paths in the manifest are relative to its directory, itself relative to the root.
+	objs, _, err := g.GenerateFile(context.Background(), filepath.Join("overlay", "generator.yaml"))
+	if err != nil {
+		t.Fatalf("GenerateFile failed: %v", err)
+	}
+	if len(objs) != 1 || objs[0].GetName() != "plain" {
+		t.Errorf("unexpected objects:\n%s", objs)
+	}
+
+	// Files are confined to the root.
+	_, _, err = g.Generate(context.Background(), &ksops.Spec{Files: []ksops.FileSource{{Path: filepath.Join(outside, "secret.yaml")}}})
+	if err == nil || !strings.Contains(err.Error(), "outside of the kustomization root") {
+		t.Errorf("expected a file outside of the root to be rejected, got %v", err)
+	}
+}
+
+func TestGeneratorGenerateFileOutsideRoot(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, root, "secret.yaml", plainSecret)
+	// kustomize passes legacy plugins a copy of their manifest in a temporary
+	// directory, which may hold a file of the same name.
+	tmp := t.TempDir()
+	writeFile(t, tmp, "secret.yaml", strings.Replace(plainSecret, "name: plain", "name: decoy", 1))
+	manifest := writeFile(t, tmp, "generator.yaml", "apiVersion: viaduct.ai/v1\nkind: ksops\nmetadata:\n  name: test\nfiles:\n  - secret.yaml\n")
+	t.Chdir(root)
+
+	objs, _, err := ksops.New(ksops.WithDecryptor(ksopstest.Decryptor{})).GenerateFile(context.Background(), manifest)
+	if err != nil {
+		t.Fatalf("GenerateFile failed: %v", err)
+	}
+	if len(objs) != 1 || objs[0].GetName() != "plain" {
+		t.Errorf("expected the file to resolve against the working directory, got:\n%s", objs)
+	}
+}
+
+// concurrencyDecryptor is a Decryptor recording the maximum number of
+// concurrent decryptions.
+type concurrencyDecryptor struct {
+	mu              sync.Mutex
+	running, maxRun int
+}
+
+func (d *concurrencyDecryptor) Decrypt(_ context.Context, data []byte, format formats.Format) ([]byte, error) {
+	d.mu.Lock()
+	d.running++
+	d.maxRun = max(d.maxRun, d.running)
+	d.mu.Unlock()
+	time.Sleep(10 * time.Millisecond)
+	d.mu.Lock()
+	d.running--
+	d.mu.Unlock()
+	return data, nil
+}
+
+func TestGeneratorWithConcurrency(t *testing.T) {
+	dir := t.TempDir()
+	var files []ksops.FileSource
+	for _, name := range []string{"a.yaml", "b.yaml", "c.yaml", "d.yaml"} {
+		files = append(files, ksops.FileSource{Path: writeFile(t, dir, name, plainSecret)})
+	}
+
+	d := &concurrencyDecryptor{}
+	if _, _, err := ksops.New(ksops.WithRoot(dir), ksops.WithConcurrency(1), ksops.WithDecryptor(d)).Generate(context.Background(), &ksops.Spec{Files: files}); err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if d.maxRun != 1 {
+		t.Errorf("expected at most 1 concurrent decryption, got %d", d.maxRun)
+	}
+
+	_, _, err := ksops.New(ksops.WithRoot(dir), ksops.WithConcurrency(0), ksops.WithDecryptor(d)).Generate(context.Background(), &ksops.Spec{Files: files})
+	if err == nil || !strings.Contains(err.Error(), "invalid concurrency") {
+		t.Errorf("expected an invalid concurrency to be rejected, got %v", err)
+	}
+}
+
+func TestGeneratorIgnoresEnv(t *testing.T) {
+	t.Setenv("KSOPS_CONCURRENCY_LIMIT", "abc")
+	t.Setenv("KSOPS_LOAD_RESTRICTOR", "LoadRestrictionsNone")
+	root := t.TempDir()
+	outside := writeFile(t, t.TempDir(), "secret.yaml", plainSecret)
+
+	// Only the ksops binary applies the KSOPS_* environment variables.
+	g := ksops.New(ksops.WithRoot(root), ksops.WithDecryptor(ksopstest.Decryptor{}))
+	if _, _, err := g.Generate(context.Background(), &ksops.Spec{Files: []ksops.FileSource{{Path: writeFile(t, root, "secret.yaml", plainSecret)}}}); err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	_, _, err := g.Generate(context.Background(), &ksops.Spec{Files: []ksops.FileSource{{Path: outside}}})
+	if err == nil || !strings.Contains(err.Error(), "outside of the kustomization root") {
+		t.Errorf("expected KSOPS_LOAD_RESTRICTOR to be ignored, got %v", err)
+	}
+}
+
+func TestGeneratorWithLogger(t *testing.T) {
+	dir := t.TempDir()
+	file := writeFile(t, dir, "secret.yaml", plainSecret)
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	if _, _, err := ksops.New(ksops.WithRoot(dir), ksops.WithLogger(logger), ksops.WithDecryptor(ksopstest.Decryptor{})).Generate(context.Background(), &ksops.Spec{Files: []ksops.FileSource{{Path: file}}}); err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if !strings.Contains(buf.String(), "decrypted file") || !strings.Contains(buf.String(), file) {
+		t.Errorf("expected the decrypted file to be logged, got %q", buf.String())
+	}
+}
+
+func TestGeneratorValidatesFiles(t *testing.T) {
+	g := ksopstest.NewGenerator(fstest.MapFS{
+		"secret.yaml": {Data: []byte(plainSecret + "---\napiVersion: v1\nkind: Secret\nmetadata:\n  name: invalid\ndata:\n  password: hunter2\n")},
+	})
+	fc, err := fn.ParseKubeObject([]byte("apiVersion: viaduct.ai/v1\nkind: ksops\nmetadata:\n  name: test\nfiles:\n  - secret.yaml\n"))
+	if err != nil {
+		t.Fatalf("failed to parse function config: %v", err)
+	}
+	rl := &fn.ResourceList{FunctionConfig: fc}
+	if ok, err := g.Process(rl); ok || err == nil {
+		t.Fatal("expected the invalid Secret to be rejected")
+	}
+	if len(rl.Results) != 1 {
+		t.Fatalf("expected 1 result, got %v", rl.Results)
+	}
+	r := rl.Results[0]
+	if r.Field == nil || r.Field.Path != "files[0]" || r.File == nil || r.File.Path != "secret.yaml" {
+		t.Errorf("expected an error at files[0] for secret.yaml, got %+v", r)
+	}
+	if !strings.Contains(r.Message, `"secret.yaml": document 1: secret "invalid"`) {
+		t.Errorf("expected the error to name the file and document, got %q", r.Message)
+	}
+}
+
+func TestGeneratorProcessPlaceholdersPerDirectory(t *testing.T) {
+	g := ksopstest.NewGenerator(fstest.MapFS{
+		"a/s.yaml": {Data: []byte("v: from-a\n")},
+		"b/s.yaml": {Data: []byte("v: from-b\n")},
+	})
+	object := func(dir string) *fn.KubeObject {
+		obj, err := fn.ParseKubeObject([]byte(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: ` + dir + `
+  annotations:
+    config.kubernetes.io/path: ` + dir + `/configmap.yaml
+data:
+  value: <ksops:s.yaml#.v>
+`))
+		if err != nil {
+			t.Fatalf("failed to parse object: %v", err)
+		}
+		return obj
+	}
+
+	// The same placeholder refers to a different file in each directory.
+	rl := &fn.ResourceList{Items: fn.KubeObjects{object("a"), object("b")}}
+	if ok, err := g.Process(rl); !ok || err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+	for i, want := range []string{"from-a", "from-b"} {
+		if got := rl.Items[i].GetMap("data").GetString("value"); got != want {
+			t.Errorf("item %d value = %q, want %q", i, got, want)
+		}
+	}
+}
@@ -0,0 +1,439 @@
+// Copyright 2019 viaduct.ai
+// SPDX-License-Identifier: Apache-2.0
+
+package ksops
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/GoogleContainerTools/kpt-functions-sdk/go/fn"
+	"github.com/getsops/sops/v3/cmd/sops/formats"
+	"golang.org/x/sync/errgroup"
+	"sigs.k8s.io/kustomize/api/types"
+)
+
+// decryptAll concurrently decrypts a list of files using the provided group,
+// returning results in the same order as the input. Each file first waits for
+// the pools of the key providers returned by providers, if not nil, and only
+// then for one of the concurrent decryptions of the group, so that files
+// waiting on a busy key provider leave the group to the others. fn is then
+// called with the context of a single file, whose timeout starts once the file
+// is scheduled, and called again after a transient error within the file
+// timeout. The first failure cancels pending decryptions, unless the group
+// aggregates errors: then every item is attempted and all failures are
+// returned.
+func decryptAll[S, T any](g *decryptGroup, items []S, providers func(file S) []string, fn func(ctx context.Context, file S) (T, error)) ([]T, error) {
+	results := make([]T, len(items))
+	errs := make([]error, len(items))
+	for i, file := range items {
+		g.group.Go(func() error {
+			var keys []string
+			if providers != nil {
+				keys = providers(file)
+			}
+			release, err := g.schedule(keys)
+			if err != nil {
+				return err
+			}
+			defer release()
+			if g.ctx.Err() != nil {
+				return context.Cause(g.ctx)
+			}
+
+			ctx, cancel := g.fileContext()
+			defer cancel()
+			var v T
+			err = g.retry.do(ctx, func() (err error) {
+				v, err = fn(ctx, file)
+				return err
+			})
+			if err != nil {
+				errs[i] = err
+				if g.aggregate {
+					return nil
+				}
+				g.cancel(err)
+				return err
+			}
+			results[i] = v
+			return nil
+		})
+	}
+	err := g.group.Wait()
+	if g.aggregate {
+		err = newDecryptionErrors(append(errs, err)...)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+type kubernetesSecret struct {
+	APIVersion string            `json:"apiVersion" yaml:"apiVersion"`
+	Kind       string            `json:"kind" yaml:"kind"`
+	Metadata   types.ObjectMeta  `json:"metadata" yaml:"metadata"`
+	Type       string            `json:"type,omitempty" yaml:"type,omitempty"`
+	Immutable  bool              `json:"immutable,omitempty" yaml:"immutable,omitempty"`
+	StringData map[string]string `json:"stringData,omitempty" yaml:"stringData,omitempty"`
+	Data       map[string]string `json:"data,omitempty" yaml:"data,omitempty"`
+}
+
+type kubernetesConfigMap struct {
+	APIVersion string            `json:"apiVersion" yaml:"apiVersion"`
+	Kind       string            `json:"kind" yaml:"kind"`
+	Metadata   types.ObjectMeta  `json:"metadata" yaml:"metadata"`
+	Immutable  bool              `json:"immutable,omitempty" yaml:"immutable,omitempty"`
+	Data       map[string]string `json:"data,omitempty" yaml:"data,omitempty"`
+	BinaryData map[string]string `json:"binaryData,omitempty" yaml:"binaryData,omitempty"`
+}
+
+// decryptGroup runs decryptions concurrently.
+type decryptGroup struct {
+	group errgroup.Group
+	// slots limits the number of concurrent decryptions.
+	slots chan struct{}
+	// aggregate makes decryptions continue after a failure, so that every
+	// failure is reported at once.
+	aggregate bool
+	// ctx is cancelled by the overall timeout, and by the first failure unless
+	// errors are aggregated.
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+	// fileTimeout limits the decryption of each file, if not 0.
+	fileTimeout time.Duration
+	// retry retries the decryption of a file after a transient error.
+	retry retryPolicy
+	// fsys is the filesystem encrypted files are read from.
+	fsys fs.FS
+	// decryptor decrypts the encrypted content.
+	decryptor Decryptor
+	// pools limit the decryptions of each key provider.
+	pools providerPools
+	// tlsExpiryWarning is how long before a TLS certificate expires to warn
+	// about it.
+	tlsExpiryWarning time.Duration
+	// log logs decrypted files at debug level.
+	log *slog.Logger
+}
+
+// newDecryptGroup returns a decryptGroup limited to the concurrency of the
+// Generator, which aggregates errors if the Generator does. The overall and
+// per-file timeouts are those of the Generator, or else the timeout and
+// fileTimeout of the spec. Transient errors are retried with the retry policy
+// of the Generator, and decryptions are scheduled into the pools of its
+// provider limits, with its Decryptor. The group must be stopped once done.
+func (ks *Generator) newDecryptGroup(ctx context.Context, timeout, fileTimeout string) (*decryptGroup, error) {
+	g := decryptGroup{
+		aggregate:        ks.aggregate,
+		retry:            ks.retry,
+		fsys:             ks.fsys,
+		decryptor:        ks.decryptor,
+		tlsExpiryWarning: ks.tlsExpiryWarning,
+		log:              ks.logger,
+	}
+	overall, err := decryptTimeout(ks.timeout, "timeout", timeout)
+	if err != nil {
+		return nil, err
+	}
+	g.fileTimeout, err = decryptTimeout(ks.fileTimeout, "fileTimeout", fileTimeout)
+	if err != nil {
+		return nil, err
+	}
+	if err := g.retry.validate(); err != nil {
+		return nil, err
+	}
+	g.retry.log = ks.logger
+	g.pools, err = newProviderPools(ks.providerLimits)
+	if err != nil {
+		return nil, err
+	}
+	if ks.tlsExpiryWarning < 0 {
+		return nil, fmt.Errorf("invalid TLS expiry warning %s: must not be negative", ks.tlsExpiryWarning)
+	}
+	if ks.concurrency < 1 {
+		return nil, fmt.Errorf("invalid concurrency %d: must be a positive integer", ks.concurrency)
+	}
+	g.slots = make(chan struct{}, ks.concurrency)
+
+	g.ctx, g.cancel = context.WithCancelCause(ctx)
+	if overall > 0 {
+		var cancel context.CancelFunc
+		g.ctx, cancel = context.WithTimeoutCause(g.ctx, overall, timeoutError("timeout", overall))
+		stop := g.cancel
+		g.cancel = func(cause error) {
+			stop(cause)
+			cancel()
+		}
+	}
+	return &g, nil
+}
+
+// stop cancels the pending decryptions of the group.
+func (g *decryptGroup) stop() {
+	g.cancel(context.Canceled)
+}
+
+// schedule waits for a slot in the pools of the given key providers, and then
+// for one of the concurrent decryptions of the group. It returns the function
+// releasing them.
+func (g *decryptGroup) schedule(providers []string) (func(), error) {
+	release, err := g.pools.acquire(g.ctx, providers)
+	if err != nil {
+		if g.ctx.Err() != nil {
+			return nil, context.Cause(g.ctx)
+		}
+		return nil, err
+	}
+	select {
+	case g.slots <- struct{}{}:
+		return func() {
+			<-g.slots
+			release()
+		}, nil
+	case <-g.ctx.Done():
+		release()
+		return nil, context.Cause(g.ctx)
+	}
+}
+
+// fileContext returns the context to decrypt a single file with.
+func (g *decryptGroup) fileContext() (context.Context, context.CancelFunc) {
+	if g.fileTimeout == 0 {
+		return context.WithCancel(g.ctx)
+	}
+	return context.WithTimeoutCause(g.ctx, g.fileTimeout, timeoutError("file timeout", g.fileTimeout))
+}
+
+// functionAnnotation is set on the function config by kustomize exec KRM functions.
+const functionAnnotation = "config.kubernetes.io/function"
+
+// Process runs the Generator as a KRM function, such as with
+// fn.AsMain(fn.ResourceListProcessorFunc(g.Process)). SOPS encrypted items are
+// decrypted in place and <ksops:path#selector> placeholders in them are
+// substituted, so KSOPS can also be used as a transformer. Other items are
+// passed through unchanged.
+//
+// kustomize passes a generator manifest, annotated with config.kubernetes.io/function,
+// both as the function config and as an item. ksops items are then replaced by
+// the resources they generate. Otherwise, as with kpt fn eval and kpt fn render,
+// the ksops spec is read from the function config, the resources it generates
+// are appended to the items, and ksops items are preserved.
+func (ks *Generator) Process(rl *fn.ResourceList) (bool, error) {
+	var timeout, fileTimeout string
+	if fc := rl.FunctionConfig; fc != nil && fc.GetKind() == "ksops" {
+		timeout, fileTimeout = fc.GetString("timeout"), fc.GetString("fileTimeout")
+	}
+	g, err := ks.newDecryptGroup(context.Background(), timeout, fileTimeout)
+	if err != nil {
+		rl.Results = append(rl.Results, errorResults(err, rl.FunctionConfig)...)
+		return false, err
+	}
+	defer g.stop()
+
+	var resources []*resource
+	for _, obj := range rl.Items {
+		if obj.GetKind() == "ksops" {
+			continue
+		}
+		r, err := newResource(obj)
+		if err != nil {
+			err = newResourceError(obj, err)
+			rl.Results = append(rl.Results, errorResults(err, nil)...)
+			return false, err
+		}
+		resources = append(resources, r)
+	}
+	resources, err = decryptAll(g, resources, func(r *resource) []string {
+		if !r.encrypted {
+			return nil
+		}
+		return g.keyTypes(r.yaml, formats.Yaml)
+	}, func(ctx context.Context, r *resource) (*resource, error) {
+		if !r.encrypted {
+			return r, nil
+		}
+		d, err := g.decryptResource(ctx, r)
+		if err != nil {
+			return nil, newResourceError(r.obj, fmt.Errorf("error decrypting %s %q: %w", r.obj.GetKind(), r.obj.GetName(), err))
+		}
+		return d, nil
+	})
+	if err != nil {
+		rl.Results = append(rl.Results, errorResults(err, nil)...)
+		return false, err
+	}
+
+	var configured string
+	if rl.FunctionConfig != nil && rl.FunctionConfig.GetKind() == "ksops" {
+		configured = rl.FunctionConfig.GetString("loadRestrictor")
+	}
+	restrictor, err := loadRestrictor(ks.loadRestrictor, configured)
+	if err != nil {
+		err = newFieldError("loadRestrictor", "", err)
+		rl.Results = append(rl.Results, errorResults(err, rl.FunctionConfig)...)
+		return false, err
+	}
+	ph, err := findPlaceholders(resources, ks.fsys, ks.root, restrictor)
+	if err != nil {
+		rl.Results = append(rl.Results, errorResults(err, nil)...)
+		return false, err
+	}
+
+	var spec *fn.KubeObject
+	if fc := rl.FunctionConfig; fc != nil && fc.GetKind() == "ksops" && fc.GetAnnotation(functionAnnotation) == "" {
+		spec = fc
+	}
+
+	// The files referenced by placeholders and by every generator are planned
+	// together, so that each is decrypted once, in a single pass. Every
+	// generator is planned and built, so that the errors of all of them are
+	// reported.
+	p := newDecryptPlan()
+	if err := ph.plan(p); err != nil {
+		rl.Results = append(rl.Results, errorResults(err, nil)...)
+		return false, err
+	}
+	var manifests fn.KubeObjects
+	if spec == nil {
+		for _, obj := range rl.Items {
+			if obj.GetKind() == "ksops" {
+				manifests = append(manifests, obj)
+			}
+		}
+	} else if hasGeneratorSpec(spec) {
+		manifests = fn.KubeObjects{spec}
+	}
+	generators := make(map[*fn.KubeObject]*expandedManifest, len(manifests))
+	var errs []error
+	for _, manifest := range manifests {
+		gen, err := expandObject(manifest, ks.fsys, ks.root, ks.loadRestrictor)
+		if err != nil {
+			rl.Results = append(rl.Results, errorResults(err, manifest)...)
+			errs = append(errs, err)
+			continue
+		}
+		if err := gen.plan(p); err != nil {
+			rl.Results = append(rl.Results, errorResults(err, manifest)...)
+			errs = append(errs, err)
+			continue
+		}
+		generators[manifest] = gen
+	}
+
+	if err := p.decrypt(g); err != nil {
+		rl.Results = append(rl.Results, errorResults(err, nil)...)
+		return false, errors.Join(append(errs, err)...)
+	}
+	substituted, err := ph.substitute(p)
+	if err != nil {
+		rl.Results = append(rl.Results, errorResults(err, nil)...)
+		return false, err
+	}
+
+	var items fn.KubeObjects
+	for _, manifest := range rl.Items {
+		if manifest.GetKind() != "ksops" {
+			items = append(items, substituted[0])
+			substituted = substituted[1:]
+			continue
+		}
+		if spec != nil {
+			items = append(items, manifest)
+			continue
+		}
+
+		gen, ok := generators[manifest]
+		if !ok {
+			continue
+		}
+		objs, err := generateObjects(g, p, rl, manifest, gen)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		items = append(items, objs...)
+	}
+
+	if gen, ok := generators[spec]; ok {
+		objs, err := generateObjects(g, p, rl, spec, gen)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		items = append(items, objs...)
+	}
+	if len(errs) > 0 {
+		return false, errors.Join(errs...)
+	}
+
+	rl.Items = items
+
+	return true, nil
+}
+
+// generateObjects returns the resources built by the generator of a ksops
+// manifest from the files decrypted by p, adding its results to the
+// ResourceList. Results are reported against the manifest unless they are
+// about a generated resource.
+func generateObjects(g *decryptGroup, p *decryptPlan, rl *fn.ResourceList, manifest *fn.KubeObject, gen *expandedManifest) (fn.KubeObjects, error) {
+	objs, results, err := gen.build(g, p)
+	if err != nil {
+		rl.Results = append(rl.Results, errorResults(err, manifest)...)
+		return nil, err
+	}
+	for _, r := range results {
+		if r.ResourceRef == nil {
+			r.ResourceRef = resourceRef(manifest)
+		}
+		if r.File == nil {
+			if path := manifestPath(manifest); path != "" {
+				r.File = &fn.File{Path: path}
+			}
+		}
+	}
+	rl.Results = append(rl.Results, results...)
+	return objs, nil
+}
+
+// hasGeneratorSpec reports whether a ksops manifest generates resources, rather
+// than only configuring KSOPS as a transformer.
+func hasGeneratorSpec(manifest *fn.KubeObject) bool {
+	for _, field := range []string{"files", "secretFrom", "configMapFrom"} {
+		if _, found, _ := manifest.NestedSlice(field); found {
+			return true
+		}
+	}
+	return false
+}
+
+// decryptData decrypts SOPS encrypted content in the given format. When ctx
+// is done first, the key providers of the content are named in the error, as
+// one of them is stuck. The timeouts do not bound the call itself: its
+// provider slot is released on return, while an abandoned SOPS call may still
+// be running.
+func (g *decryptGroup) decryptData(ctx context.Context, b []byte, format formats.Format) ([]byte, error) {
+	data, err := g.decryptor.Decrypt(ctx, b, format)
+	if err != nil && ctx.Err() != nil {
+		return nil, fmt.Errorf("gave up waiting on key provider %s: %w", keyProviders(b, format), context.Cause(ctx))
+	}
+	return data, err
+}
+
+// fileKeyPath splits a key=path file reference. Without a key, the key is the
+// file name.
+func fileKeyPath(file string) (string, string, error) {
+	slices := strings.Split(file, "=")
+	if len(slices) == 1 {
+		return filepath.Base(file), file, nil
+	} else if len(slices) > 2 {
+		return "", "", fmt.Errorf("invalid format in file generator %s", file)
+	}
+	return slices[0], slices[1], nil
+}
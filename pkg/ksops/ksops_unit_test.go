@@ -1,9 +1,12 @@
 // Copyright 2019 viaduct.ai
 // SPDX-License-Identifier: Apache-2.0
 
-package main
+package ksops
 
 import (
+	"bytes"
+	"context"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"os"
@@ -13,7 +16,7 @@ import (
 	"sync/atomic"
 	"testing"
 
-	"golang.org/x/sync/errgroup"
+	"github.com/GoogleContainerTools/kpt-functions-sdk/go/fn"
 )
 
 func importTestKey(t *testing.T) {
@@ -53,14 +56,41 @@ func makeManifest(files []string, secretFrom ...string) []byte {
 	return []byte(b.String())
 }
 
+// newTestDecryptGroup returns the decryptGroup of a Generator configured by
+// opts, stopped when the test ends.
+func newTestDecryptGroup(t *testing.T, opts ...Option) *decryptGroup {
+	t.Helper()
+	g, err := New(opts...).newDecryptGroup(context.Background(), "", "")
+	if err != nil {
+		t.Fatalf("newDecryptGroup failed: %v", err)
+	}
+	t.Cleanup(g.stop)
+	return g
+}
+
+// generate runs a ksops manifest with a Generator configured by opts,
+// returning the output as YAML.
+func generate(ctx context.Context, raw []byte, dir string, opts ...Option) (string, fn.Results, error) {
+	objs, results, err := New(opts...).generate(ctx, raw, dir)
+	if err != nil {
+		return "", results, err
+	}
+	return objs.String(), results, nil
+}
+
+// krm processes a ResourceList with a Generator configured by opts.
+func krm(rl *fn.ResourceList, opts ...Option) (bool, error) {
+	return New(opts...).Process(rl)
+}
+
 // --- decryptAll tests (no SOPS needed) ---
 
 func TestDecryptAllOrderPreservation(t *testing.T) {
-	var g errgroup.Group
-	g.SetLimit(10)
+	g := newTestDecryptGroup(t)
+	g.slots = make(chan struct{}, 10)
 
 	items := []string{"a", "b", "c", "d", "e"}
-	results, err := decryptAll(&g, items, func(file string) (string, error) {
+	results, err := decryptAll(g, items, nil, func(_ context.Context, file string) (string, error) {
 		return "result-" + file, nil
 	})
 	if err != nil {
@@ -78,10 +108,10 @@ func TestDecryptAllOrderPreservation(t *testing.T) {
 }
 
 func TestDecryptAllEmpty(t *testing.T) {
-	var g errgroup.Group
-	g.SetLimit(10)
+	g := newTestDecryptGroup(t)
+	g.slots = make(chan struct{}, 10)
 
-	results, err := decryptAll(&g, nil, func(file string) (string, error) {
+	results, err := decryptAll(g, nil, nil, func(_ context.Context, file string) (string, error) {
 		t.Fatal("should not be called for nil input")
 		return "", nil
 	})
@@ -92,7 +122,7 @@ func TestDecryptAllEmpty(t *testing.T) {
 		t.Fatalf("expected 0 results, got %d", len(results))
 	}
 
-	results, err = decryptAll(&g, []string{}, func(file string) (string, error) {
+	results, err = decryptAll(g, []string{}, nil, func(_ context.Context, file string) (string, error) {
 		t.Fatal("should not be called for empty input")
 		return "", nil
 	})
@@ -105,12 +135,12 @@ func TestDecryptAllEmpty(t *testing.T) {
 }
 
 func TestDecryptAllErrorPropagation(t *testing.T) {
-	var g errgroup.Group
-	g.SetLimit(10)
+	g := newTestDecryptGroup(t)
+	g.slots = make(chan struct{}, 10)
 
 	sentinel := errors.New("decrypt failed")
 	items := []string{"a", "b", "c"}
-	_, err := decryptAll(&g, items, func(file string) (string, error) {
+	_, err := decryptAll(g, items, nil, func(_ context.Context, file string) (string, error) {
 		if file == "b" {
 			return "", sentinel
 		}
@@ -125,8 +155,8 @@ func TestDecryptAllErrorPropagation(t *testing.T) {
 }
 
 func TestDecryptAllConcurrency(t *testing.T) {
-	var g errgroup.Group
-	g.SetLimit(5)
+	g := newTestDecryptGroup(t)
+	g.slots = make(chan struct{}, 5)
 
 	var running atomic.Int32
 	var maxRunning atomic.Int32
@@ -136,7 +166,7 @@ func TestDecryptAllConcurrency(t *testing.T) {
 		items[i] = fmt.Sprintf("file-%d", i)
 	}
 
-	results, err := decryptAll(&g, items, func(file string) (string, error) {
+	results, err := decryptAll(g, items, nil, func(_ context.Context, file string) (string, error) {
 		cur := running.Add(1)
 		// Track max concurrent goroutines
 		for {
@@ -170,7 +200,7 @@ func TestGenerateSingleFile(t *testing.T) {
 	file := testFixturePath(t, "test", "legacy", "single", "secret.enc.yaml")
 	manifest := makeManifest([]string{file})
 
-	got, err := generate(manifest)
+	got, _, err := generate(context.Background(), manifest, "")
 	if err != nil {
 		t.Fatalf("generate failed: %v", err)
 	}
@@ -193,7 +223,7 @@ func TestGenerateMultipleFiles(t *testing.T) {
 		filepath.Join(dir, "secret-C.enc.yaml"),
 	})
 
-	got, err := generate(manifest)
+	got, _, err := generate(context.Background(), manifest, "")
 	if err != nil {
 		t.Fatalf("generate failed: %v", err)
 	}
@@ -222,7 +252,7 @@ func TestGenerateSecretFromFiles(t *testing.T) {
   files:
   - %s`, file))
 
-	got, err := generate(manifest)
+	got, _, err := generate(context.Background(), manifest, "")
 	if err != nil {
 		t.Fatalf("generate failed: %v", err)
 	}
@@ -249,7 +279,7 @@ func TestGenerateSecretFromBinaryFiles(t *testing.T) {
   binaryFiles:
   - %s`, file))
 
-	got, err := generate(manifest)
+	got, _, err := generate(context.Background(), manifest, "")
 	if err != nil {
 		t.Fatalf("generate failed: %v", err)
 	}
@@ -273,7 +303,7 @@ func TestGenerateSecretFromEnvs(t *testing.T) {
   envs:
   - %s`, file))
 
-	got, err := generate(manifest)
+	got, _, err := generate(context.Background(), manifest, "")
 	if err != nil {
 		t.Fatalf("generate failed: %v", err)
 	}
@@ -289,6 +319,42 @@ func TestGenerateSecretFromEnvs(t *testing.T) {
 	}
 }
 
+func TestGenerateConfigMapFrom(t *testing.T) {
+	importTestKey(t)
+
+	dir := testFixturePath(t, "test", "krm", "configmap")
+	manifest := makeManifest(nil, fmt.Sprintf(`configMapFrom:
+- metadata:
+    name: myconfig
+  files:
+  - settings.yaml=%s
+  binaryFiles:
+  - %s
+  envs:
+  - %s`, filepath.Join(dir, "settings.enc.yaml"), filepath.Join(dir, "settings.enc.yaml"), filepath.Join(dir, "config.enc.env")))
+
+	got, _, err := generate(context.Background(), manifest, "")
+	if err != nil {
+		t.Fatalf("generate failed: %v", err)
+	}
+
+	for _, want := range []string{
+		"kind: ConfigMap",
+		"name: myconfig",
+		"API_ENDPOINT: https://internal.example.com",
+		"settings.yaml: |",
+		"binaryData:",
+		"settings.enc.yaml: " + base64.StdEncoding.EncodeToString([]byte("endpoint: https://internal.example.com\nretries: 3\n")),
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output missing %q:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "kind: Secret") {
+		t.Errorf("configMapFrom should not generate a Secret:\n%s", got)
+	}
+}
+
 func TestGenerateFilesAndSecretFrom(t *testing.T) {
 	importTestKey(t)
 
@@ -306,7 +372,7 @@ func TestGenerateFilesAndSecretFrom(t *testing.T) {
   - %s`, file),
 	)
 
-	got, err := generate(manifest)
+	got, _, err := generate(context.Background(), manifest, "")
 	if err != nil {
 		t.Fatalf("generate failed: %v", err)
 	}
@@ -320,50 +386,35 @@ func TestGenerateFilesAndSecretFrom(t *testing.T) {
 
 // --- concurrency limit tests ---
 
-func TestConcurrencyLimitEnvVar(t *testing.T) {
+func TestConcurrencyLimit(t *testing.T) {
 	importTestKey(t)
 
 	file := testFixturePath(t, "test", "legacy", "single", "secret.enc.yaml")
 	manifest := makeManifest([]string{file})
 
 	t.Run("valid limit", func(t *testing.T) {
-		t.Setenv("KSOPS_CONCURRENCY_LIMIT", "5")
-		_, err := generate(manifest)
+		_, _, err := generate(context.Background(), manifest, "", WithConcurrency(5))
 		if err != nil {
 			t.Fatalf("generate failed with valid limit: %v", err)
 		}
 	})
 
-	t.Run("invalid non-numeric", func(t *testing.T) {
-		t.Setenv("KSOPS_CONCURRENCY_LIMIT", "abc")
-		_, err := generate(manifest)
-		if err == nil {
-			t.Fatal("expected error for non-numeric limit")
-		}
-		if !strings.Contains(err.Error(), "KSOPS_CONCURRENCY_LIMIT") {
-			t.Errorf("error should mention KSOPS_CONCURRENCY_LIMIT: %v", err)
-		}
-	})
-
 	t.Run("invalid zero", func(t *testing.T) {
-		t.Setenv("KSOPS_CONCURRENCY_LIMIT", "0")
-		_, err := generate(manifest)
-		if err == nil {
-			t.Fatal("expected error for zero limit")
+		_, _, err := generate(context.Background(), manifest, "", WithConcurrency(0))
+		if err == nil || !strings.Contains(err.Error(), "invalid concurrency 0") {
+			t.Fatalf("expected error for zero limit, got %v", err)
 		}
 	})
 
 	t.Run("invalid negative", func(t *testing.T) {
-		t.Setenv("KSOPS_CONCURRENCY_LIMIT", "-1")
-		_, err := generate(manifest)
+		_, _, err := generate(context.Background(), manifest, "", WithConcurrency(-1))
 		if err == nil {
 			t.Fatal("expected error for negative limit")
 		}
 	})
 
-	t.Run("default when unset", func(t *testing.T) {
-		t.Setenv("KSOPS_CONCURRENCY_LIMIT", "")
-		_, err := generate(manifest)
+	t.Run("default", func(t *testing.T) {
+		_, _, err := generate(context.Background(), manifest, "")
 		if err != nil {
 			t.Fatalf("generate failed with default limit: %v", err)
 		}
@@ -371,20 +422,20 @@ func TestConcurrencyLimitEnvVar(t *testing.T) {
 }
 
 func TestGenerateErrors(t *testing.T) {
-	t.Run("missing files and secretFrom", func(t *testing.T) {
+	t.Run("missing files, secretFrom and configMapFrom", func(t *testing.T) {
 		manifest := []byte(`apiVersion: viaduct.ai/v1
 kind: ksops
 metadata:
   name: test
 `)
-		_, err := generate(manifest)
+		_, _, err := generate(context.Background(), manifest, "")
 		if err == nil {
-			t.Fatal("expected error for missing files and secretFrom")
+			t.Fatal("expected error for missing files, secretFrom and configMapFrom")
 		}
 	})
 
 	t.Run("invalid yaml", func(t *testing.T) {
-		_, err := generate([]byte(`{invalid`))
+		_, _, err := generate(context.Background(), []byte(`{invalid`), "")
 		if err == nil {
 			t.Fatal("expected error for invalid YAML")
 		}
@@ -392,9 +443,125 @@ metadata:
 
 	t.Run("nonexistent file", func(t *testing.T) {
 		manifest := makeManifest([]string{"/nonexistent/file.yaml"})
-		_, err := generate(manifest)
+		_, _, err := generate(context.Background(), manifest, "")
 		if err == nil {
 			t.Fatal("expected error for nonexistent file")
 		}
 	})
 }
+
+// --- krm tests ---
+
+// kptResourceList returns a ResourceList, as kpt passes it to a function, with
+// a plain ConfigMap and a ksops manifest as items and functionConfig as the
+// function config.
+func kptResourceList(t *testing.T, functionConfig string) *fn.ResourceList {
+	t.Helper()
+	rl, err := fn.ParseResourceList([]byte(`apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: v1
+  kind: ConfigMap
+  metadata:
+    name: myconfig
+  data:
+    mode: plain
+- apiVersion: viaduct.ai/v1
+  kind: ksops
+  metadata:
+    name: other-generator
+    annotations:
+      config.kubernetes.io/local-config: "true"
+  files:
+  - ./other.enc.yaml
+functionConfig:
+` + functionConfig))
+	if err != nil {
+		t.Fatalf("failed to parse resource list: %v", err)
+	}
+	return rl
+}
+
+func TestKRMFunctionConfig(t *testing.T) {
+	importTestKey(t)
+
+	rl := kptResourceList(t, `  apiVersion: viaduct.ai/v1
+  kind: ksops
+  metadata:
+    name: ksops-secret-from-generator
+    annotations:
+      config.kubernetes.io/path: test/legacy/envs/generate-resources.yaml
+  secretFrom:
+  - metadata:
+      name: mysecret
+    envs:
+    - ./secret.enc.env
+`)
+	configMap, generator := rl.Items[0].String(), rl.Items[1].String()
+
+	if ok, err := krm(rl); !ok || err != nil {
+		t.Fatalf("krm failed: %v", err)
+	}
+	if len(rl.Items) != 3 {
+		t.Fatalf("expected 3 items, got %d:\n%s", len(rl.Items), rl.Items)
+	}
+	if rl.Items[0].String() != configMap {
+		t.Errorf("ConfigMap was modified:\n%s", rl.Items[0])
+	}
+	if rl.Items[1].String() != generator {
+		t.Errorf("ksops item was modified:\n%s", rl.Items[1])
+	}
+	if rl.Items[2].GetKind() != "Secret" || rl.Items[2].GetName() != "mysecret" {
+		t.Errorf("expected the generated Secret to be appended:\n%s", rl.Items[2])
+	}
+}
+
+func TestKRMFunctionConfigWithoutGeneratorSpec(t *testing.T) {
+	rl := kptResourceList(t, `  apiVersion: viaduct.ai/v1
+  kind: ksops
+  metadata:
+    name: ksops-decrypt-transformer
+`)
+	if ok, err := krm(rl); !ok || err != nil {
+		t.Fatalf("krm failed: %v", err)
+	}
+	if len(rl.Items) != 2 {
+		t.Fatalf("expected the items to be preserved, got %d:\n%s", len(rl.Items), rl.Items)
+	}
+}
+
+func TestKRMKustomizeExec(t *testing.T) {
+	importTestKey(t)
+
+	manifest := makeManifest([]string{testFixturePath(t, "test", "legacy", "single", "secret.enc.yaml")})
+	manifest = bytes.Replace(manifest, []byte("  name: test\n"), []byte("  name: test\n  annotations:\n    config.kubernetes.io/function: |\n      exec:\n        path: ksops\n"), 1)
+	obj, err := fn.ParseKubeObject(manifest)
+	if err != nil {
+		t.Fatalf("failed to parse manifest: %v", err)
+	}
+	rl := &fn.ResourceList{Items: fn.KubeObjects{obj}, FunctionConfig: obj}
+
+	if ok, err := krm(rl); !ok || err != nil {
+		t.Fatalf("krm failed: %v", err)
+	}
+	if len(rl.Items) != 1 || rl.Items[0].GetKind() != "Secret" {
+		t.Errorf("expected the generator to be replaced by its Secret, got:\n%s", rl.Items)
+	}
+}
+
+func TestHasGeneratorSpec(t *testing.T) {
+	for manifest, want := range map[string]bool{
+		"kind: ksops\nfiles:\n- ./secret.enc.yaml\n":              true,
+		"kind: ksops\nsecretFrom:\n- metadata:\n    name: s\n":    true,
+		"kind: ksops\nconfigMapFrom:\n- metadata:\n    name: c\n": true,
+		"kind: ksops\nloadRestrictor: LoadRestrictionsNone\n":     false,
+	} {
+		obj, err := fn.ParseKubeObject([]byte("apiVersion: viaduct.ai/v1\nmetadata:\n  name: test\n" + manifest))
+		if err != nil {
+			t.Fatalf("failed to parse manifest: %v", err)
+		}
+		if got := hasGeneratorSpec(obj); got != want {
+			t.Errorf("hasGeneratorSpec(%q) = %v, want %v", manifest, got, want)
+		}
+	}
+}
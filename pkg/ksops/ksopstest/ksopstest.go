@@ -0,0 +1,39 @@
+// Copyright 2026 viaduct.ai
+// SPDX-License-Identifier: Apache-2.0
+
+// Package ksopstest provides an in-memory ksops Generator, to test ksops
+// manifests without any key material.
+package ksopstest
+
+import (
+	"context"
+	"testing/fstest"
+
+	"github.com/getsops/sops/v3/cmd/sops/common"
+	"github.com/getsops/sops/v3/cmd/sops/formats"
+	"github.com/getsops/sops/v3/config"
+	"github.com/viaduct-ai/kustomize-sops/pkg/ksops"
+)
+
+// Decryptor is a ksops.Decryptor for test fixtures written in plaintext. It
+// returns the content without its sops metadata, if it has any, and without
+// decrypting its values: encrypted values are returned as is.
+type Decryptor struct{}
+
+// Decrypt returns data without its sops metadata.
+func (Decryptor) Decrypt(_ context.Context, data []byte, format formats.Format) ([]byte, error) {
+	store := common.StoreForFormat(format, config.NewStoresConfig())
+	tree, err := store.LoadEncryptedFile(data)
+	if err != nil {
+		// Content without sops metadata is already plaintext.
+		return data, nil
+	}
+	return store.EmitPlainFile(tree.Branches)
+}
+
+// NewGenerator returns a ksops.Generator reading manifests and files from
+// files, with paths relative to its root, and decrypting them with Decryptor.
+// opts are applied after these.
+func NewGenerator(files fstest.MapFS, opts ...ksops.Option) *ksops.Generator {
+	return ksops.New(append([]ksops.Option{ksops.WithFS(files), ksops.WithDecryptor(Decryptor{})}, opts...)...)
+}
@@ -0,0 +1,102 @@
+// Copyright 2026 viaduct.ai
+// SPDX-License-Identifier: Apache-2.0
+
+package ksopstest
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/getsops/sops/v3/cmd/sops/formats"
+	"github.com/viaduct-ai/kustomize-sops/pkg/ksops"
+)
+
+func TestDecryptorStripsMetadata(t *testing.T) {
+	encrypted, err := os.ReadFile(filepath.Join("..", "..", "..", "test", "legacy", "single", "secret.enc.yaml"))
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+	got, err := Decryptor{}.Decrypt(context.Background(), encrypted, formats.Yaml)
+	if err != nil {
+		t.Fatalf("Decrypt failed: %v", err)
+	}
+	if strings.Contains(string(got), "sops:") {
+		t.Errorf("expected the sops metadata to be removed, got:\n%s", got)
+	}
+	if !strings.Contains(string(got), "name: mysecret") {
+		t.Errorf("expected the content to be kept, got:\n%s", got)
+	}
+}
+
+func TestDecryptorPlaintext(t *testing.T) {
+	for _, tc := range []struct {
+		data   string
+		format formats.Format
+	}{
+		{data: "password: hunter2\n", format: formats.Yaml},
+		{data: `{"password": "hunter2"}`, format: formats.Json},
+		{data: "PASSWORD=hunter2\n", format: formats.Dotenv},
+		{data: "\x00\x01binary", format: formats.Binary},
+	} {
+		got, err := Decryptor{}.Decrypt(context.Background(), []byte(tc.data), tc.format)
+		if err != nil {
+			t.Fatalf("Decrypt(%q) failed: %v", tc.data, err)
+		}
+		if string(got) != tc.data {
+			t.Errorf("Decrypt(%q) = %q, want the content as is", tc.data, got)
+		}
+	}
+}
+
+func TestNewGenerator(t *testing.T) {
+	files := fstest.MapFS{
+		"overlay/generator.yaml": {Data: []byte(`apiVersion: viaduct.ai/v1
+kind: ksops
+metadata:
+  name: test
+files:
+  - secret.yaml
+secretFrom:
+  - metadata:
+      name: app
+    envs:
+      - app.env
+    files:
+      - config/*.json
+`)},
+		"overlay/secret.yaml":      {Data: []byte("apiVersion: v1\nkind: Secret\nmetadata:\n  name: plain\nstringData:\n  password: hunter2\n")},
+		"overlay/app.env":          {Data: []byte("USER=admin\n")},
+		"overlay/config/a.json":    {Data: []byte(`{"a": 1}`)},
+		"overlay/config/b.json":    {Data: []byte(`{"b": 2}`)},
+		"elsewhere/secret.yaml":    {Data: []byte("apiVersion: v1\nkind: Secret\nmetadata:\n  name: elsewhere\n")},
+		"overlay/outside-ref.yaml": {Data: []byte("apiVersion: viaduct.ai/v1\nkind: ksops\nmetadata:\n  name: test\nfiles:\n  - ../elsewhere/secret.yaml\n")},
+	}
+
+	objs, _, err := NewGenerator(files).GenerateFile(context.Background(), "overlay/generator.yaml")
+	if err != nil {
+		t.Fatalf("GenerateFile failed: %v", err)
+	}
+	if len(objs) != 2 {
+		t.Fatalf("expected 2 objects, got %d:\n%s", len(objs), objs)
+	}
+	app := objs[1]
+	for key, want := range map[string]string{"USER": "admin", "a.json": `{"a": 1}`, "b.json": `{"b": 2}`} {
+		if got, _, _ := app.NestedString("stringData", key); got != want {
+			t.Errorf("expected %s to be %q, got %q:\n%s", key, want, got, app)
+		}
+	}
+
+	// The root confines files within the filesystem.
+	_, _, err = NewGenerator(files).GenerateFile(context.Background(), "overlay/outside-ref.yaml")
+	if err != nil {
+		t.Fatalf("expected files within the filesystem root to be allowed: %v", err)
+	}
+	_, _, err = NewGenerator(files, ksops.WithRoot("overlay")).GenerateFile(context.Background(), "outside-ref.yaml")
+	if err == nil || !strings.Contains(err.Error(), "outside of the kustomization root") {
+		t.Errorf("expected a file outside of the root to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright 2026 viaduct.ai
+// SPDX-License-Identifier: Apache-2.0
+
+package ksops
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/GoogleContainerTools/kpt-functions-sdk/go/fn"
+	goyaml "go.yaml.in/yaml/v3"
+)
+
+// parseLiteral splits a key=value literal source. Like kustomize's literal
+// sources, a value wrapped in matching quotes has the quotes removed.
+func parseLiteral(literal string) (string, string, error) {
+	key, value, ok := strings.Cut(literal, "=")
+	if !ok || key == "" {
+		return "", "", fmt.Errorf("invalid literal %q: expected key=value", literal)
+	}
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		value = value[1 : len(value)-1]
+	}
+	return key, value, nil
+}
+
+// encryptedLiteralBlocks returns the raw encryptedLiterals block of every
+// secretFrom entry, keyed by the entry's index. SOPS computes its MAC over the
+// values in document order, so the blocks are re-encoded from the original YAML
+// nodes rather than from the order-losing manifest struct.
+func encryptedLiteralBlocks(raw []byte) (map[int][]byte, error) {
+	var doc goyaml.Node
+	if err := goyaml.Unmarshal(raw, &doc); err != nil {
+		return nil, fmt.Errorf("error unmarshalling manifest content: %w", err)
+	}
+
+	blocks := make(map[int][]byte)
+	if len(doc.Content) == 0 {
+		return blocks, nil
+	}
+
+	entries := mappingValue(doc.Content[0], "secretFrom")
+	if entries == nil || entries.Kind != goyaml.SequenceNode {
+		return blocks, nil
+	}
+	for i, entry := range entries.Content {
+		block := mappingValue(entry, "encryptedLiterals")
+		if block == nil {
+			continue
+		}
+		b, err := goyaml.Marshal(block)
+		if err != nil {
+			return nil, fmt.Errorf("error marshalling secretFrom[%d].encryptedLiterals: %w", i, err)
+		}
+		blocks[i] = b
+	}
+	return blocks, nil
+}
+
+// objectLiteralBlocks is encryptedLiteralBlocks for a manifest read from a
+// ResourceList, whose nodes keep the document order.
+func objectLiteralBlocks(obj *fn.KubeObject) (map[int][]byte, error) {
+	blocks := make(map[int][]byte)
+	entries, _, err := obj.NestedSlice("secretFrom")
+	if err != nil {
+		return nil, fmt.Errorf("error reading secretFrom: %w", err)
+	}
+	for i, entry := range entries {
+		if block := entry.GetMap("encryptedLiterals"); block != nil {
+			blocks[i] = []byte(block.String())
+		}
+	}
+	return blocks, nil
+}
+
+// parseEncryptedLiterals returns the top-level keys and scalar values of a
+// decrypted encryptedLiterals block.
+func parseEncryptedLiterals(data []byte) (map[string]string, error) {
+	var doc goyaml.Node
+	if err := goyaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("error unmarshalling decrypted encryptedLiterals: %w", err)
+	}
+
+	literals := make(map[string]string)
+	if len(doc.Content) == 0 {
+		return literals, nil
+	}
+	m := doc.Content[0]
+	if m.Kind != goyaml.MappingNode {
+		return nil, fmt.Errorf("encryptedLiterals must be a map of keys to values")
+	}
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		key, value := m.Content[i], m.Content[i+1]
+		if value.Kind != goyaml.ScalarNode {
+			return nil, fmt.Errorf("encryptedLiterals key %q must have a scalar value", key.Value)
+		}
+		literals[key.Value] = value.Value
+	}
+	return literals, nil
+}
+
+// mappingValue returns the value node for key in a YAML mapping node, or nil.
+func mappingValue(node *goyaml.Node, key string) *goyaml.Node {
+	if node == nil || node.Kind != goyaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,221 @@
+// Copyright 2026 viaduct.ai
+// SPDX-License-Identifier: Apache-2.0
+
+package ksops
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/GoogleContainerTools/kpt-functions-sdk/go/fn"
+	"github.com/getsops/sops/v3/cmd/sops/formats"
+	goyaml "go.yaml.in/yaml/v3"
+	"sigs.k8s.io/yaml"
+)
+
+func TestParseLiteral(t *testing.T) {
+	tests := []struct {
+		literal string
+		key     string
+		value   string
+		wantErr bool
+	}{
+		{literal: "username=admin", key: "username", value: "admin"},
+		{literal: "token=a=b=c", key: "token", value: "a=b=c"},
+		{literal: "empty=", key: "empty", value: ""},
+		{literal: `quoted="hello world"`, key: "quoted", value: "hello world"},
+		{literal: "single='hello'", key: "single", value: "hello"},
+		{literal: `mismatched="hello'`, key: "mismatched", value: `"hello'`},
+		{literal: "novalue", wantErr: true},
+		{literal: "=value", wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.literal, func(t *testing.T) {
+			key, value, err := parseLiteral(tc.literal)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("expected error for %q", tc.literal)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if key != tc.key || value != tc.value {
+				t.Errorf("parseLiteral(%q) = (%q, %q), want (%q, %q)", tc.literal, key, value, tc.key, tc.value)
+			}
+		})
+	}
+}
+
+func TestEncryptedLiteralBlocksPreservesOrder(t *testing.T) {
+	manifest := []byte(`apiVersion: viaduct.ai/v1
+kind: ksops
+secretFrom:
+- metadata:
+    name: first
+  literals:
+  - a=b
+- metadata:
+    name: second
+  encryptedLiterals:
+    zeta: ENC[zeta]
+    alpha: ENC[alpha]
+    sops:
+      version: 3.7.2
+`)
+
+	for name, blockFunc := range map[string]func([]byte) (map[int][]byte, error){
+		"yaml": encryptedLiteralBlocks,
+		"object": func(raw []byte) (map[int][]byte, error) {
+			obj, err := fn.ParseKubeObject(raw)
+			if err != nil {
+				return nil, err
+			}
+			return objectLiteralBlocks(obj)
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			blocks, err := blockFunc(manifest)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if _, ok := blocks[0]; ok {
+				t.Errorf("secretFrom[0] has no encryptedLiterals block, got %q", blocks[0])
+			}
+			got := string(blocks[1])
+			if strings.Index(got, "zeta") > strings.Index(got, "alpha") {
+				t.Errorf("encryptedLiterals keys were reordered:\n%s", got)
+			}
+			if !strings.Contains(got, "sops:") {
+				t.Errorf("encryptedLiterals block is missing the sops metadata:\n%s", got)
+			}
+		})
+	}
+}
+
+func TestGenerateSecretFromLiterals(t *testing.T) {
+	importTestKey(t)
+
+	raw, err := os.ReadFile(testFixturePath(t, "test", "krm", "literals", "generate-resources.yaml"))
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+
+	got, _, err := generate(context.Background(), raw, "")
+	if err != nil {
+		t.Fatalf("generate failed: %v", err)
+	}
+
+	for _, want := range []string{
+		"username: admin",
+		`port: "5432"`,
+		"password: 1f2d1e2e67df",
+		"apiKey: c2VjcmV0LWFwaS1rZXk",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output missing %q:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "ENC[") || strings.Contains(got, "sops") {
+		t.Errorf("output contains encrypted data or sops metadata:\n%s", got)
+	}
+}
+
+func TestGenerateEncryptedLiteralsAggregateErrors(t *testing.T) {
+	// The encryptedLiterals blocks are decrypted along with the files, and
+	// their failures are aggregated with those of the files.
+	failing := DecryptorFunc(func(_ context.Context, data []byte, format formats.Format) ([]byte, error) {
+		return nil, errors.New("no key could decrypt the data key")
+	})
+	dir := t.TempDir()
+	writeFiles(t, dir, "secret.enc.yaml")
+	file := filepath.Join(dir, "secret.enc.yaml")
+	manifest := makeManifest([]string{file}, `secretFrom:
+- metadata:
+    name: first
+  encryptedLiterals:
+    password: ENC[...]
+- metadata:
+    name: second
+  encryptedLiterals:
+    token: ENC[...]`)
+
+	_, _, err := generate(context.Background(), manifest, "", WithLoadRestrictor(loadRestrictionsNone), WithAggregateErrors(true), WithDecryptor(failing))
+	var combined decryptionErrors
+	if !errors.As(err, &combined) || len(combined) != 3 {
+		t.Fatalf("expected 3 failures, got %v", err)
+	}
+	var fields []string
+	for _, err := range combined {
+		var fe *fieldError
+		if errors.As(err, &fe) {
+			fields = append(fields, fe.field)
+		}
+	}
+	sort.Strings(fields)
+	if want := []string{"files[0]", "secretFrom[0].encryptedLiterals", "secretFrom[1].encryptedLiterals"}; !slices.Equal(fields, want) {
+		t.Errorf("expected failures at %v, got %v", want, fields)
+	}
+	if !strings.Contains(err.Error(), "error decrypting secretFrom.EncryptedLiterals") {
+		t.Errorf("expected the encryptedLiterals failures to be named, got %v", err)
+	}
+}
+
+func TestGeneratorGenerateEncryptedLiterals(t *testing.T) {
+	importTestKey(t)
+
+	raw, err := os.ReadFile(testFixturePath(t, "test", "krm", "literals", "generate-resources.yaml"))
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+	// Unmarshalled from YAML, a Spec keeps encryptedLiterals in document order.
+	var spec Spec
+	if err := goyaml.Unmarshal(raw, &spec); err != nil {
+		t.Fatalf("failed to unmarshal fixture: %v", err)
+	}
+
+	objs, _, err := New().Generate(context.Background(), &spec)
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if got, _, _ := objs[0].NestedString("stringData", "password"); got != "1f2d1e2e67df" {
+		t.Errorf("expected the decrypted literal, got %q:\n%s", got, objs[0])
+	}
+}
+
+func TestRawYAMLUnmarshalJSON(t *testing.T) {
+	var sg SecretGenerator
+	if err := yaml.Unmarshal([]byte("encryptedLiterals: null\n"), &sg); err != nil || sg.EncryptedLiterals != nil {
+		t.Errorf("expected a null block to be unset, got %q, %v", sg.EncryptedLiterals, err)
+	}
+	if err := yaml.Unmarshal([]byte("encryptedLiterals:\n  password: ENC[...]\n"), &sg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := string(sg.EncryptedLiterals); got != `{"password":"ENC[...]"}` {
+		t.Errorf("unexpected block %q", got)
+	}
+}
+
+func TestGenerateSecretFromInvalidLiteral(t *testing.T) {
+	manifest := makeManifest(nil, `secretFrom:
+- metadata:
+    name: mysecret
+  literals:
+  - novalue`)
+
+	_, _, err := generate(context.Background(), manifest, "")
+	if err == nil {
+		t.Fatal("expected error for invalid literal")
+	}
+	if !strings.Contains(err.Error(), "novalue") {
+		t.Errorf("error should mention the invalid literal: %v", err)
+	}
+}
@@ -0,0 +1,19 @@
+// Copyright 2026 viaduct.ai
+// SPDX-License-Identifier: Apache-2.0
+
+package ksops
+
+import (
+	"fmt"
+	"os"
+	"testing"
+)
+
+// TestMain runs the tests from the repository root, where the test fixtures are.
+func TestMain(m *testing.M) {
+	if err := os.Chdir("../.."); err != nil {
+		fmt.Fprintf(os.Stderr, "error changing to the repository root: %v\n", err)
+		os.Exit(1)
+	}
+	os.Exit(m.Run())
+}
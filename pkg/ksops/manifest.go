@@ -0,0 +1,506 @@
+// Copyright 2026 viaduct.ai
+// SPDX-License-Identifier: Apache-2.0
+
+package ksops
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/fs"
+	"strings"
+	"time"
+
+	"github.com/GoogleContainerTools/kpt-functions-sdk/go/fn"
+	"sigs.k8s.io/yaml"
+)
+
+// expandedManifest is a ksops manifest with its file references expanded,
+// ready to be planned, and then built once the files are decrypted.
+type expandedManifest struct {
+	manifest Spec
+	// resource is the ksops resource in a ResourceList, if any.
+	resource   *fn.ResourceRef
+	files      []located[FileSource]
+	secrets    []generatorSources
+	configMaps []generatorSources
+	// literals are the planned encryptedLiterals blocks of the secretFrom
+	// entries, by index.
+	literals map[int]*plannedFile
+}
+
+// located is an expanded entry of a ksops manifest, with the field it was
+// listed at, such as secretFrom[2].envs[0].
+type located[T any] struct {
+	field string
+	value T
+}
+
+// generatorSources are the expanded files, binaryFiles and envs of a
+// secretFrom or configMapFrom entry.
+type generatorSources struct {
+	// field is the entry, such as secretFrom[2], and section the list it is
+	// in, such as secretFrom.
+	field, section string
+	files          []keyFile
+	binaryFiles    []keyFile
+	envs           []envFile
+}
+
+// keyFile is an expanded key=path#selector entry of files or binaryFiles.
+type keyFile struct {
+	field string
+	// entry is the expanded entry, as listed in key conflicts.
+	entry               string
+	key, path, selector string
+	// format is the SOPS format set for the file, if any.
+	format string
+}
+
+// envFile is an expanded entry of envs, with the format of its decrypted
+// content and the SOPS format set for the file, if any.
+type envFile struct {
+	field      string
+	source     EnvSource
+	format     string
+	sopsFormat string
+}
+
+// expandManifest parses a ksops manifest and expands its file references.
+// Relative paths are resolved against dir, the manifest's directory relative
+// to root, and confined to root, the kustomization root, unless the load
+// restrictor, the one of the Generator if set or else of the manifest, is
+// disabled. The manifest can only disable it if the Generator does. Files are read from fsys.
+func expandManifest(raw []byte, fsys fs.FS, root, dir, restrictor string) (*expandedManifest, error) {
+	gen := &expandedManifest{}
+	err := yaml.Unmarshal(raw, &gen.manifest)
+
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshalling manifest content: %q \n%s", err, raw)
+	}
+
+	if !gen.manifest.generates() {
+		return nil, fmt.Errorf("missing the required 'files', 'secretFrom' or 'configMapFrom' key in the ksops manifests: %s", raw)
+	}
+	if gen.manifest.hasEncryptedLiterals() {
+		blocks, err := encryptedLiteralBlocks(raw)
+		if err != nil {
+			return nil, newFieldError("secretFrom", "", err)
+		}
+		gen.manifest.setEncryptedLiterals(blocks)
+	}
+	if err := gen.expand(fsys, root, dir, restrictor); err != nil {
+		return nil, err
+	}
+	return gen, nil
+}
+
+// expandObject is expandManifest for a ksops manifest read from a
+// ResourceList, which is converted without serializing it back to YAML.
+func expandObject(obj *fn.KubeObject, fsys fs.FS, root, restrictor string) (*expandedManifest, error) {
+	gen := &expandedManifest{resource: resourceRef(obj)}
+	if err := obj.As(&gen.manifest); err != nil {
+		return nil, fmt.Errorf("error unmarshalling manifest content: %w", err)
+	}
+
+	if !gen.manifest.generates() {
+		return nil, fmt.Errorf("missing the required 'files', 'secretFrom' or 'configMapFrom' key in the ksops manifests: %s", obj)
+	}
+	if gen.manifest.hasEncryptedLiterals() {
+		blocks, err := objectLiteralBlocks(obj)
+		if err != nil {
+			return nil, newFieldError("secretFrom", "", err)
+		}
+		gen.manifest.setEncryptedLiterals(blocks)
+	}
+	if err := gen.expand(fsys, root, manifestDir(obj), restrictor); err != nil {
+		return nil, err
+	}
+	return gen, nil
+}
+
+// generates reports whether the manifest lists anything to generate.
+func (s Spec) generates() bool {
+	return s.Files != nil || s.SecretFrom != nil || s.ConfigMapFrom != nil
+}
+
+// hasEncryptedLiterals reports whether any secretFrom entry has an
+// encryptedLiterals block.
+func (s Spec) hasEncryptedLiterals() bool {
+	for _, sf := range s.SecretFrom {
+		if sf.EncryptedLiterals != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// setEncryptedLiterals replaces the encryptedLiterals of the secretFrom
+// entries with blocks, by index, read in the order of the manifest.
+func (s Spec) setEncryptedLiterals(blocks map[int][]byte) {
+	for i, block := range blocks {
+		s.SecretFrom[i].EncryptedLiterals = block
+	}
+}
+
+// expand expands the file references of the manifest, resolving relative
+// paths against dir, relative to the kustomization root. restrictor overrides
+// the load restrictor of the manifest, if set.
+func (gen *expandedManifest) expand(fsys fs.FS, root, dir, restrictor string) error {
+	manifest := gen.manifest
+	restrictor, err := loadRestrictor(restrictor, manifest.LoadRestrictor)
+	if err != nil {
+		return newFieldError("loadRestrictor", "", err)
+	}
+	loader, err := newFileLoader(fsys, root, dir, restrictor)
+	if err != nil {
+		return newFieldError("loadRestrictor", "", err)
+	}
+
+	for i, source := range manifest.Files {
+		field := fmt.Sprintf("files[%d]", i)
+		format, err := parseFormat(source.Format)
+		if err != nil {
+			return newFieldError(field+".format", source.Path, fmt.Errorf("error parsing manifest.Files: %w", err))
+		}
+		expanded, err := loader.expandPath(source.Path)
+		if err != nil {
+			return newFieldError(field, source.Path, fmt.Errorf("error expanding manifest.Files: %w", err))
+		}
+		for _, file := range expanded {
+			gen.files = append(gen.files, located[FileSource]{field: field, value: FileSource{Path: file, Format: format}})
+		}
+	}
+
+	for i, sf := range manifest.SecretFrom {
+		sources, err := expandSources(loader, fmt.Sprintf("secretFrom[%d]", i), sf.Files, sf.BinaryFiles, sf.Envs)
+		if err != nil {
+			return err
+		}
+		gen.secrets = append(gen.secrets, sources)
+	}
+	for i, cf := range manifest.ConfigMapFrom {
+		sources, err := expandSources(loader, fmt.Sprintf("configMapFrom[%d]", i), cf.Files, cf.BinaryFiles, cf.Envs)
+		if err != nil {
+			return err
+		}
+		gen.configMaps = append(gen.configMaps, sources)
+	}
+	return nil
+}
+
+// expandSources expands the files, binaryFiles and envs of a secretFrom or
+// configMapFrom entry at field.
+func expandSources(loader fileLoader, field string, files, binaryFiles []FileSource, envs []EnvSource) (generatorSources, error) {
+	section, _, _ := strings.Cut(field, "[")
+	sources := generatorSources{field: field, section: section}
+
+	var err error
+	sources.files, err = expandKeyFiles(loader, field+".files", section+".Files", files)
+	if err != nil {
+		return generatorSources{}, err
+	}
+	sources.binaryFiles, err = expandKeyFiles(loader, field+".binaryFiles", section+".BinaryFiles", binaryFiles)
+	if err != nil {
+		return generatorSources{}, err
+	}
+	for i, env := range envs {
+		envField := fmt.Sprintf("%s.envs[%d]", field, i)
+		sopsFormat, err := parseFormat(env.SopsFormat)
+		if err != nil {
+			return generatorSources{}, newFieldError(envField+".sopsFormat", env.Path, fmt.Errorf("error parsing %s.Envs: %w", section, err))
+		}
+		expanded, err := loader.expandEnvSources([]EnvSource{env})
+		if err != nil {
+			return generatorSources{}, newFieldError(envField, env.Path, fmt.Errorf("error expanding %s.Envs: %w", section, err))
+		}
+		for _, source := range expanded {
+			format, err := envFormat(source)
+			if err != nil {
+				return generatorSources{}, newFieldError(envField, source.Path, fmt.Errorf("error parsing file %q from %s.Envs: %w", source.Path, section, err))
+			}
+			sources.envs = append(sources.envs, envFile{field: envField, source: source, format: format, sopsFormat: sopsFormat})
+		}
+	}
+	return sources, nil
+}
+
+// expandKeyFiles expands the key=path#selector entries of a field, keeping the
+// field and index each expanded entry was listed at, and its format.
+func expandKeyFiles(loader fileLoader, field, name string, entries []FileSource) ([]keyFile, error) {
+	var expanded []keyFile
+	for i, entry := range entries {
+		entryField := fmt.Sprintf("%s[%d]", field, i)
+		format, err := parseFormat(entry.Format)
+		if err != nil {
+			return nil, newFieldError(entryField+".format", "", fmt.Errorf("error parsing %s: %w", name, err))
+		}
+		refs, err := loader.expandKeyPaths([]string{entry.Path})
+		if err != nil {
+			return nil, newFieldError(entryField, "", fmt.Errorf("error expanding %s: %w", name, err))
+		}
+		for _, ref := range refs {
+			key, path, selector, err := fileKeyPathSelector(ref, loader.exists)
+			if err != nil {
+				return nil, newFieldError(entryField, "", fmt.Errorf("error parsing %q from %s: %w", ref, name, err))
+			}
+			expanded = append(expanded, keyFile{field: entryField, entry: ref, key: key, path: path, selector: selector, format: format})
+		}
+	}
+	return expanded, nil
+}
+
+// plan adds the files and encryptedLiterals blocks of the manifest to p. It
+// fails if a file is referenced with conflicting SOPS formats.
+func (gen *expandedManifest) plan(p *decryptPlan) error {
+	gen.literals = make(map[int]*plannedFile)
+	for i, sf := range gen.manifest.SecretFrom {
+		if sf.EncryptedLiterals != nil {
+			gen.literals[i] = p.addLiterals(sf.EncryptedLiterals, fileRef{field: gen.secrets[i].field + ".encryptedLiterals", origin: "secretFrom.EncryptedLiterals", resource: gen.resource})
+		}
+	}
+	for _, file := range gen.files {
+		if err := p.add(file.value.Path, fileRef{field: file.field, origin: "from manifest.Files", format: file.value.Format, resource: gen.resource}); err != nil {
+			return err
+		}
+	}
+	for _, sources := range append(gen.secrets, gen.configMaps...) {
+		for _, file := range sources.files {
+			if err := p.add(file.path, fileRef{field: file.field, origin: "from " + sources.section + ".Files", format: file.format, resource: gen.resource}); err != nil {
+				return err
+			}
+		}
+		for _, file := range sources.binaryFiles {
+			if err := p.add(file.path, fileRef{field: file.field, origin: "from " + sources.section + ".BinaryFiles", format: file.format, resource: gen.resource}); err != nil {
+				return err
+			}
+		}
+		for _, env := range sources.envs {
+			if err := p.add(env.source.Path, fileRef{field: env.field, origin: "from " + sources.section + ".Envs", format: env.sopsFormat, resource: gen.resource}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// build builds the secrets and config maps of the manifest from the files
+// decrypted by p, along with the resources of its files. Errors about a field
+// of the manifest are fieldErrors, and the returned results hold warnings.
+func (gen *expandedManifest) build(g *decryptGroup, p *decryptPlan) (fn.KubeObjects, fn.Results, error) {
+	manifest := gen.manifest
+
+	var objs fn.KubeObjects
+	for _, file := range gen.files {
+		parsed, err := parseResources(p.data(file.value.Path))
+		if err != nil {
+			return nil, nil, newFieldError(file.field, file.value.Path, fmt.Errorf("error parsing decrypted file %q: %w", file.value.Path, err))
+		}
+		objs = append(objs, parsed...)
+	}
+
+	// When errors are aggregated, the failures of files are collected and
+	// the remaining entries are still built.
+	var failures []error
+
+	var results fn.Results
+	for i, sf := range manifest.SecretFrom {
+		field := gen.secrets[i].field
+		keys, err := newKeyCollector(sf.OnConflict)
+		if err != nil {
+			return nil, nil, newFieldError(field+".onConflict", "", fmt.Errorf("error parsing secretFrom.OnConflict: %w", err))
+		}
+
+		warnings, err := gen.secrets[i].collect(g, p, keys)
+		if err != nil {
+			if !g.aggregate {
+				return nil, nil, err
+			}
+			failures = append(failures, err)
+			continue
+		}
+		results = append(results, warnings...)
+
+		for j, literal := range sf.Literals {
+			literalField := fmt.Sprintf("%s.literals[%d]", field, j)
+			k, v, err := parseLiteral(literal)
+			if err != nil {
+				return nil, nil, newFieldError(literalField, "", fmt.Errorf("error parsing secretFrom.Literals: %w", err))
+			}
+			if err := keys.add(k, v, literalField, false); err != nil {
+				return nil, nil, newFieldError(literalField, "", fmt.Errorf("error building secret %q: %w", sf.Metadata.Name, err))
+			}
+		}
+
+		if block, ok := gen.literals[i]; ok {
+			literalsField := block.ref.field
+			literals, err := parseEncryptedLiterals(block.data)
+			if err != nil {
+				return nil, nil, newFieldError(literalsField, "", fmt.Errorf("error parsing secretFrom.EncryptedLiterals: %w", err))
+			}
+			if err := keys.addAll(literals, literalsField); err != nil {
+				return nil, nil, newFieldError(literalsField, "", fmt.Errorf("error building secret %q: %w", sf.Metadata.Name, err))
+			}
+		}
+
+		metadata, err := applyGeneratorOptions(sf.Metadata, sf.Options)
+		if err != nil {
+			return nil, nil, newFieldError(field+".options", "", fmt.Errorf("error parsing secretFrom.Options: %w", err))
+		}
+
+		s := kubernetesSecret{
+			APIVersion: "v1",
+			Kind:       "Secret",
+			Metadata:   metadata,
+			Type:       sf.Type,
+			Immutable:  sf.Options != nil && sf.Options.Immutable,
+			StringData: keys.stringData,
+			Data:       keys.binaryData,
+		}
+		if replacement, ok := deprecatedSecretTypes[s.Type]; ok {
+			results = append(results, warningResult(fmt.Sprintf("secret type %q is deprecated, use %q instead", s.Type, replacement), field+".type", ""))
+		}
+		if err := buildTypedSecret(&s); err != nil {
+			return nil, nil, newFieldError(field+".type", "", err)
+		}
+		if s.Type == secretTypeTLS {
+			warning, err := validateTLSSecret(&s, time.Now(), g.tlsExpiryWarning)
+			if err != nil {
+				return nil, nil, newFieldError(field, "", err)
+			}
+			if warning != "" {
+				results = append(results, &fn.Result{
+					Message:  warning,
+					Severity: fn.Warning,
+					ResourceRef: &fn.ResourceRef{
+						APIVersion: s.APIVersion,
+						Kind:       s.Kind,
+						Name:       s.Metadata.Name,
+						Namespace:  s.Metadata.Namespace,
+					},
+				})
+			}
+		}
+		obj, err := fn.NewFromTypedObject(&s)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error marshalling manifest: %w", err)
+		}
+		objs = append(objs, obj)
+	}
+
+	for i, cf := range manifest.ConfigMapFrom {
+		field := gen.configMaps[i].field
+		keys, err := newKeyCollector(cf.OnConflict)
+		if err != nil {
+			return nil, nil, newFieldError(field+".onConflict", "", fmt.Errorf("error parsing configMapFrom.OnConflict: %w", err))
+		}
+
+		warnings, err := gen.configMaps[i].collect(g, p, keys)
+		if err != nil {
+			if !g.aggregate {
+				return nil, nil, err
+			}
+			failures = append(failures, err)
+			continue
+		}
+		results = append(results, warnings...)
+
+		metadata, err := applyGeneratorOptions(cf.Metadata, cf.Options)
+		if err != nil {
+			return nil, nil, newFieldError(field+".options", "", fmt.Errorf("error parsing configMapFrom.Options: %w", err))
+		}
+
+		cm := kubernetesConfigMap{
+			APIVersion: "v1",
+			Kind:       "ConfigMap",
+			Metadata:   metadata,
+			Immutable:  cf.Options != nil && cf.Options.Immutable,
+			Data:       keys.stringData,
+			BinaryData: keys.binaryData,
+		}
+		obj, err := fn.NewFromTypedObject(&cm)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error marshalling manifest: %w", err)
+		}
+		objs = append(objs, obj)
+	}
+
+	if err := newDecryptionErrors(failures...); err != nil {
+		return nil, nil, err
+	}
+
+	return objs, results, nil
+}
+
+// collect adds the keys of the decrypted files, binaryFiles and envs to the
+// collector, base64 encoding binary data. It returns warnings for empty env
+// files. When errors are aggregated, every file is processed before failing.
+func (s generatorSources) collect(g *decryptGroup, p *decryptPlan, keys *keyCollector) (fn.Results, error) {
+	var failures []error
+	fail := func(err error) error {
+		if !g.aggregate {
+			return err
+		}
+		failures = append(failures, err)
+		return nil
+	}
+
+	selectKey := func(file keyFile, name string) ([]byte, error) {
+		data := p.data(file.path)
+		if file.selector == "" {
+			return data, nil
+		}
+		value, err := selectValue(data, p.format(file.path), file.selector)
+		if err != nil {
+			return nil, newFieldError(file.field, file.path, fmt.Errorf("error selecting value from file %q in %s.%s: %w", file.path, s.section, name, err))
+		}
+		return []byte(value), nil
+	}
+
+	for _, file := range s.files {
+		data, err := selectKey(file, "Files")
+		if err != nil {
+			if err := fail(err); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err := keys.add(file.key, string(data), fmt.Sprintf("%s %q", file.field, file.entry), false); err != nil {
+			return nil, newFieldError(file.field, "", err)
+		}
+	}
+	for _, file := range s.binaryFiles {
+		data, err := selectKey(file, "BinaryFiles")
+		if err != nil {
+			if err := fail(err); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err := keys.add(file.key, base64.StdEncoding.EncodeToString(data), fmt.Sprintf("%s %q", file.field, file.entry), true); err != nil {
+			return nil, newFieldError(file.field, "", err)
+		}
+	}
+
+	var warnings fn.Results
+	for _, file := range s.envs {
+		path := file.source.Path
+		env, err := parseEnv(p.data(path), file.format, file.source.Separator)
+		if err != nil {
+			if err := fail(newFieldError(file.field, path, fmt.Errorf("error unmarshalling %s env file %q: %w", file.format, path, err))); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if len(env) == 0 {
+			warnings = append(warnings, warningResult(fmt.Sprintf("env file %q does not contain any keys", path), file.field, path))
+		}
+		if err := keys.addAll(env, fmt.Sprintf("%s %q", file.field, path)); err != nil {
+			return nil, newFieldError(file.field, path, err)
+		}
+	}
+
+	if err := newDecryptionErrors(failures...); err != nil {
+		return nil, err
+	}
+	return warnings, nil
+}
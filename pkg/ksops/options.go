@@ -0,0 +1,78 @@
+// Copyright 2026 viaduct.ai
+// SPDX-License-Identifier: Apache-2.0
+
+package ksops
+
+import (
+	"fmt"
+	"strconv"
+
+	"sigs.k8s.io/kustomize/api/types"
+)
+
+// Annotations kustomize reads from the output of generator plugins.
+const (
+	needsHashAnnotation = "kustomize.config.k8s.io/needs-hash"
+	behaviorAnnotation  = "kustomize.config.k8s.io/behavior"
+)
+
+// GeneratorOptions mirrors kustomize's GeneratorOptions, plus the generator
+// behavior, for a single secretFrom or configMapFrom entry.
+type GeneratorOptions struct {
+	Labels      map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty" yaml:"annotations,omitempty"`
+	// DisableNameSuffixHash is a pointer because, unlike kustomize's generators,
+	// KSOPS does not add a hash suffix unless asked to. Leaving it unset keeps
+	// whatever the metadata annotations specify.
+	DisableNameSuffixHash *bool  `json:"disableNameSuffixHash,omitempty" yaml:"disableNameSuffixHash,omitempty"`
+	Behavior              string `json:"behavior,omitempty" yaml:"behavior,omitempty"`
+	Immutable             bool   `json:"immutable,omitempty" yaml:"immutable,omitempty"`
+}
+
+// applyGeneratorOptions returns a copy of meta with the options' labels and
+// annotations added, and the kustomize annotations for the hash suffix and
+// behavior set. Labels and annotations already in meta take precedence.
+func applyGeneratorOptions(meta types.ObjectMeta, opts *GeneratorOptions) (types.ObjectMeta, error) {
+	if opts == nil {
+		return meta, nil
+	}
+
+	switch opts.Behavior {
+	case "", "create", "merge", "replace":
+	default:
+		return meta, fmt.Errorf("invalid behavior %q: must be one of create, merge or replace", opts.Behavior)
+	}
+
+	meta.Labels = mergeStringMaps(opts.Labels, meta.Labels)
+	meta.Annotations = mergeStringMaps(opts.Annotations, meta.Annotations)
+
+	if opts.DisableNameSuffixHash != nil {
+		if meta.Annotations == nil {
+			meta.Annotations = make(map[string]string)
+		}
+		meta.Annotations[needsHashAnnotation] = strconv.FormatBool(!*opts.DisableNameSuffixHash)
+	}
+	if opts.Behavior != "" {
+		if meta.Annotations == nil {
+			meta.Annotations = make(map[string]string)
+		}
+		meta.Annotations[behaviorAnnotation] = opts.Behavior
+	}
+	return meta, nil
+}
+
+// mergeStringMaps returns a new map with the entries of base, overridden by
+// those of override. It returns nil if both maps are empty.
+func mergeStringMaps(base, override map[string]string) map[string]string {
+	if len(base) == 0 && len(override) == 0 {
+		return nil
+	}
+	merged := make(map[string]string, len(base)+len(override))
+	for k, v := range base {
+		merged[k] = v
+	}
+	for k, v := range override {
+		merged[k] = v
+	}
+	return merged
+}
@@ -0,0 +1,118 @@
+// Copyright 2026 viaduct.ai
+// SPDX-License-Identifier: Apache-2.0
+
+package ksops
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"sigs.k8s.io/kustomize/api/types"
+)
+
+func TestApplyGeneratorOptions(t *testing.T) {
+	yes, no := true, false
+
+	tests := []struct {
+		name    string
+		meta    types.ObjectMeta
+		opts    *GeneratorOptions
+		want    types.ObjectMeta
+		wantErr bool
+	}{
+		{
+			name: "nil options",
+			meta: types.ObjectMeta{Name: "s", Labels: map[string]string{"a": "b"}},
+			want: types.ObjectMeta{Name: "s", Labels: map[string]string{"a": "b"}},
+		},
+		{
+			name: "labels and annotations merged with metadata precedence",
+			meta: types.ObjectMeta{Name: "s", Labels: map[string]string{"app": "meta"}},
+			opts: &GeneratorOptions{
+				Labels:      map[string]string{"app": "opts", "team": "x"},
+				Annotations: map[string]string{"note": "y"},
+			},
+			want: types.ObjectMeta{
+				Name:        "s",
+				Labels:      map[string]string{"app": "meta", "team": "x"},
+				Annotations: map[string]string{"note": "y"},
+			},
+		},
+		{
+			name: "disable name suffix hash",
+			meta: types.ObjectMeta{Name: "s"},
+			opts: &GeneratorOptions{DisableNameSuffixHash: &yes, Behavior: "replace"},
+			want: types.ObjectMeta{Name: "s", Annotations: map[string]string{
+				needsHashAnnotation: "false",
+				behaviorAnnotation:  "replace",
+			}},
+		},
+		{
+			name: "enable name suffix hash overrides metadata",
+			meta: types.ObjectMeta{Name: "s", Annotations: map[string]string{needsHashAnnotation: "false"}},
+			opts: &GeneratorOptions{DisableNameSuffixHash: &no},
+			want: types.ObjectMeta{Name: "s", Annotations: map[string]string{needsHashAnnotation: "true"}},
+		},
+		{
+			name:    "invalid behavior",
+			meta:    types.ObjectMeta{Name: "s"},
+			opts:    &GeneratorOptions{Behavior: "upsert"},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := applyGeneratorOptions(tc.meta, tc.opts)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("applyGeneratorOptions() = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestApplyGeneratorOptionsDoesNotMutateMetadata(t *testing.T) {
+	meta := types.ObjectMeta{Name: "s", Annotations: map[string]string{"a": "b"}}
+	yes := true
+	if _, err := applyGeneratorOptions(meta, &GeneratorOptions{DisableNameSuffixHash: &yes}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(meta.Annotations) != 1 {
+		t.Errorf("metadata annotations were modified: %v", meta.Annotations)
+	}
+}
+
+func TestGenerateSecretFromOptions(t *testing.T) {
+	importTestKey(t)
+
+	file := testFixturePath(t, "test", "legacy", "envs", "secret.enc.env")
+	manifest := makeManifest(nil, `secretFrom:
+- metadata:
+    name: mysecret
+  options:
+    behavior: merge
+    immutable: true
+  envs:
+  - `+file)
+
+	got, _, err := generate(context.Background(), manifest, "")
+	if err != nil {
+		t.Fatalf("generate failed: %v", err)
+	}
+	for _, want := range []string{"immutable: true", behaviorAnnotation + ": merge"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output missing %q:\n%s", want, got)
+		}
+	}
+}
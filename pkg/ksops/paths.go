@@ -0,0 +1,312 @@
+// Copyright 2026 viaduct.ai
+// SPDX-License-Identifier: Apache-2.0
+
+package ksops
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/GoogleContainerTools/kpt-functions-sdk/go/fn"
+)
+
+// Annotations recording the file a KRM resource was read from. kustomize and
+// kpt set both, relative to the kustomization or package root.
+const (
+	pathAnnotation       = "internal.config.kubernetes.io/path"
+	legacyPathAnnotation = "config.kubernetes.io/path"
+)
+
+// Load restrictors, named after kustomize's --load-restrictor values.
+const (
+	loadRestrictionsRootOnly = "LoadRestrictionsRootOnly"
+	loadRestrictionsNone     = "LoadRestrictionsNone"
+)
+
+// fileLoader resolves and restricts the paths referenced by a manifest.
+type fileLoader struct {
+	// fsys is the filesystem files are read from.
+	fsys fs.FS
+	// dir is the directory of the manifest. Relative paths are resolved against it.
+	dir string
+	// root is the directory files must be within, or "" if loading is not restricted.
+	root string
+}
+
+// loadRestrictor returns override, the load restrictor of the Generator, or
+// configured, the one set in the manifest, if it is unset. A manifest can only
+// disable the restriction when the operator does, so that a generator cannot
+// read files outside of the kustomization root on its own.
+func loadRestrictor(override, configured string) (string, error) {
+	if override != "" {
+		return override, nil
+	}
+	if configured == loadRestrictionsNone {
+		return "", fmt.Errorf("%s must be allowed by the operator, with KSOPS_LOAD_RESTRICTOR or WithLoadRestrictor", loadRestrictionsNone)
+	}
+	return configured, nil
+}
+
+// newFileLoader returns a fileLoader for a manifest in dir, relative to root,
+// the kustomization root. An empty root is the working directory, which is the
+// kustomization root when run by kustomize, or the root of fsys. Unless
+// restrictor is LoadRestrictionsNone, files are confined to root.
+func newFileLoader(fsys fs.FS, root, dir, restrictor string) (fileLoader, error) {
+	if root != "" && !filepath.IsAbs(dir) {
+		dir = filepath.Join(root, dir)
+	}
+	switch restrictor {
+	case "", loadRestrictionsRootOnly:
+	case loadRestrictionsNone:
+		return fileLoader{fsys: fsys, dir: dir}, nil
+	default:
+		return fileLoader{}, fmt.Errorf("invalid load restrictor %q: must be %s or %s", restrictor, loadRestrictionsRootOnly, loadRestrictionsNone)
+	}
+
+	if !isOS(fsys) {
+		// Without symlinks, paths are confined lexically.
+		return fileLoader{fsys: fsys, dir: dir, root: filepath.Clean(root)}, nil
+	}
+	if root == "" {
+		wd, err := os.Getwd()
+		if err != nil {
+			return fileLoader{}, fmt.Errorf("error getting working directory: %w", err)
+		}
+		root = wd
+	}
+	abs, err := filepath.Abs(root)
+	if err == nil {
+		abs, err = filepath.EvalSymlinks(abs)
+	}
+	if err != nil {
+		return fileLoader{}, fmt.Errorf("error resolving kustomization root %q: %w", root, err)
+	}
+	root = abs
+	return fileLoader{fsys: fsys, dir: dir, root: root}, nil
+}
+
+// expandKeyPaths is expandPath for entries using the key=path syntax. Like
+// kustomize's secretGenerator, an entry without a key expands to one entry per
+// file, each keyed by its file name. An entry with a key or a #selector must
+// match a single file.
+func (l fileLoader) expandKeyPaths(entries []string) ([]string, error) {
+	var expanded []string
+	for _, entry := range entries {
+		key, path := "", entry
+		if strings.Contains(entry, "=") {
+			var err error
+			key, path, err = fileKeyPath(entry)
+			if err != nil {
+				return nil, err
+			}
+		}
+		path, selector := splitSelector(path, l.exists)
+
+		files, err := l.expandPath(path)
+		if err != nil {
+			return nil, err
+		}
+		if key == "" && selector == "" {
+			expanded = append(expanded, files...)
+			continue
+		}
+		if len(files) != 1 {
+			return nil, fmt.Errorf("%q matches %d files: a key or selector can only be set for a single file", entry, len(files))
+		}
+
+		ref := files[0]
+		if selector != "" {
+			ref += "#" + selector
+		}
+		if key != "" {
+			ref = key + "=" + ref
+		}
+		expanded = append(expanded, ref)
+	}
+	return expanded, nil
+}
+
+// exists reports whether path, resolved against the manifest's directory, is a
+// file or directory.
+func (l fileLoader) exists(path string) bool {
+	_, err := fs.Stat(l.fsys, resolvePath(l.fsys, l.dir, path))
+	return err == nil
+}
+
+// expandPath returns the files a path refers to, resolved against the
+// manifest's directory and checked against the load restrictor. A directory
+// expands to the regular files directly inside it and a glob pattern to the
+// files it matches, both in sorted order. Any other path is returned as is,
+// leaving missing files to be reported when they are read.
+func (l fileLoader) expandPath(path string) ([]string, error) {
+	files, err := expandResolvedPath(l.fsys, resolvePath(l.fsys, l.dir, path))
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		if err := l.restrict(file); err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// restrict returns an error if file, after resolving symlinks, is outside the
+// loader's root. Absolute paths are allowed as long as they are within the root.
+func (l fileLoader) restrict(file string) error {
+	if l.root == "" {
+		return nil
+	}
+	if !isOS(l.fsys) {
+		return l.restrictRel(file, filepath.Clean(file))
+	}
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return fmt.Errorf("error resolving %q: %w", file, err)
+	}
+	resolved, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		// Missing files are reported when they are read, so check where they
+		// would be, resolving the directory if it exists.
+		resolved = abs
+		if dir, err := filepath.EvalSymlinks(filepath.Dir(abs)); err == nil {
+			resolved = filepath.Join(dir, filepath.Base(abs))
+		}
+	}
+	return l.restrictRel(file, resolved)
+}
+
+// restrictRel returns an error if resolved, the resolved path of file, is
+// outside the loader's root.
+func (l fileLoader) restrictRel(file, resolved string) error {
+	rel, err := filepath.Rel(l.root, resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("%q is outside of the kustomization root %q, which is not allowed with %s", file, l.root, loadRestrictionsRootOnly)
+	}
+	return nil
+}
+
+// expandResolvedPath expands a directory or glob pattern into the files of fsys
+// it matches.
+func expandResolvedPath(fsys fs.FS, path string) ([]string, error) {
+	if info, err := fs.Stat(fsys, path); err == nil {
+		if !info.IsDir() {
+			return []string{path}, nil
+		}
+		entries, err := fs.ReadDir(fsys, path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading directory %q: %w", path, err)
+		}
+		var files []string
+		for _, entry := range entries {
+			file := filepath.Join(path, entry.Name())
+			if isFile(fsys, file) {
+				files = append(files, file)
+			}
+		}
+		if len(files) == 0 {
+			return nil, fmt.Errorf("directory %q does not contain any files", path)
+		}
+		return files, nil
+	}
+
+	if !strings.ContainsAny(path, "*?[") {
+		return []string{path}, nil
+	}
+
+	matches, err := fs.Glob(fsys, path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %w", path, err)
+	}
+	var files []string
+	for _, match := range matches {
+		if isFile(fsys, match) {
+			files = append(files, match)
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no files match pattern %q", path)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// resolvePath returns path relative to dir, the directory of the manifest that
+// references it. Absolute paths, and relative paths that do not exist under dir,
+// are returned as is and so resolve against the working directory.
+func resolvePath(fsys fs.FS, dir, path string) string {
+	if dir == "" || filepath.IsAbs(path) {
+		return path
+	}
+	candidate := filepath.Join(dir, path)
+	if _, err := fs.Stat(fsys, candidate); err == nil {
+		return candidate
+	}
+	if strings.ContainsAny(path, "*?[") {
+		if matches, _ := fs.Glob(fsys, candidate); len(matches) > 0 {
+			return candidate
+		}
+	}
+	return path
+}
+
+// manifestPath returns the file a KRM resource was read from, as recorded by
+// the orchestrator in its path annotation, or "" if it is not set.
+func manifestPath(obj *fn.KubeObject) string {
+	for _, annotation := range []string{pathAnnotation, legacyPathAnnotation} {
+		if path := obj.GetAnnotation(annotation); path != "" {
+			return path
+		}
+	}
+	return ""
+}
+
+// manifestDir returns the directory of the file a KRM generator was read from,
+// or "" if it is not known.
+func manifestDir(obj *fn.KubeObject) string {
+	if path := manifestPath(obj); path != "" {
+		return filepath.Dir(path)
+	}
+	return ""
+}
+
+// manifestDirWithin returns the directory of the manifest at path, relative to
+// root, if it is within root, or else "". Like newFileLoader, an empty root is
+// the working directory, or the root of fsys.
+func manifestDirWithin(fsys fs.FS, root, path string) string {
+	dir := filepath.Dir(path)
+	if !filepath.IsAbs(dir) {
+		if filepath.IsLocal(dir) {
+			return dir
+		}
+		return ""
+	}
+	if !isOS(fsys) {
+		return ""
+	}
+	rootDir, err := filepath.Abs(root)
+	if err != nil {
+		return ""
+	}
+	if r, err := filepath.EvalSymlinks(rootDir); err == nil {
+		rootDir = r
+	}
+	resolved := dir
+	if r, err := filepath.EvalSymlinks(dir); err == nil {
+		resolved = r
+	}
+	if rel, err := filepath.Rel(rootDir, resolved); err != nil || !filepath.IsLocal(rel) {
+		return ""
+	}
+	return dir
+}
+
+// isFile reports whether path is a regular file of fsys, following symlinks.
+func isFile(fsys fs.FS, path string) bool {
+	info, err := fs.Stat(fsys, path)
+	return err == nil && info.Mode().IsRegular()
+}
@@ -0,0 +1,335 @@
+// Copyright 2026 viaduct.ai
+// SPDX-License-Identifier: Apache-2.0
+
+package ksops
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/GoogleContainerTools/kpt-functions-sdk/go/fn"
+)
+
+// writeFiles creates empty files, and any parent directories, under dir.
+func writeFiles(t *testing.T, dir string, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatalf("failed to create file: %v", err)
+		}
+	}
+}
+
+func TestExpandPath(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir,
+		"secrets/b.enc.yaml",
+		"secrets/a.enc.yaml",
+		"secrets/c.enc.env",
+		"secrets/nested/d.enc.yaml",
+		"plain.enc.yaml",
+	)
+	j := func(parts ...string) string { return filepath.Join(append([]string{dir}, parts...)...) }
+
+	tests := []struct {
+		name    string
+		paths   []string
+		want    []string
+		wantErr string
+	}{
+		{
+			name:  "plain file",
+			paths: []string{j("plain.enc.yaml")},
+			want:  []string{j("plain.enc.yaml")},
+		},
+		{
+			name:  "missing file is left for decryption to report",
+			paths: []string{j("missing.enc.yaml")},
+			want:  []string{j("missing.enc.yaml")},
+		},
+		{
+			name:  "glob is sorted",
+			paths: []string{j("secrets", "*.enc.yaml")},
+			want:  []string{j("secrets", "a.enc.yaml"), j("secrets", "b.enc.yaml")},
+		},
+		{
+			name:  "directory skips subdirectories",
+			paths: []string{j("secrets")},
+			want:  []string{j("secrets", "a.enc.yaml"), j("secrets", "b.enc.yaml"), j("secrets", "c.enc.env")},
+		},
+		{
+			name:  "entries keep their order",
+			paths: []string{j("plain.enc.yaml"), j("secrets", "*.env")},
+			want:  []string{j("plain.enc.yaml"), j("secrets", "c.enc.env")},
+		},
+		{
+			name:    "glob without matches",
+			paths:   []string{j("secrets", "*.json")},
+			wantErr: "no files match",
+		},
+		{
+			name:  "glob in subdirectory",
+			paths: []string{j("secrets", "nested", "*")},
+			want:  []string{j("secrets", "nested", "d.enc.yaml")},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var got []string
+			var err error
+			for _, path := range tc.paths {
+				var files []string
+				if files, err = (fileLoader{fsys: osFS{}}).expandPath(path); err != nil {
+					break
+				}
+				got = append(got, files...)
+			}
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("expandPath(%v) = %v, want %v", tc.paths, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestExpandPathEmptyDirectory(t *testing.T) {
+	dir := t.TempDir()
+	_, err := fileLoader{fsys: osFS{}}.expandPath(dir)
+	if err == nil || !strings.Contains(err.Error(), "does not contain any files") {
+		t.Fatalf("expected empty directory error, got %v", err)
+	}
+}
+
+func TestExpandKeyPaths(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, "config/a.yaml", "config/b.yaml")
+	a, b := filepath.Join(dir, "config", "a.yaml"), filepath.Join(dir, "config", "b.yaml")
+
+	got, err := fileLoader{fsys: osFS{}}.expandKeyPaths([]string{filepath.Join(dir, "config"), "custom=" + filepath.Join(dir, "config", "a.*")})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{a, b, "custom=" + a}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expandKeyPaths() = %v, want %v", got, want)
+	}
+
+	_, err = fileLoader{fsys: osFS{}}.expandKeyPaths([]string{"custom=" + filepath.Join(dir, "config")})
+	if err == nil || !strings.Contains(err.Error(), "single file") {
+		t.Fatalf("expected error for a key set on a directory, got %v", err)
+	}
+}
+
+func TestGenerateGlobAndDirectory(t *testing.T) {
+	importTestKey(t)
+
+	dir := testFixturePath(t, "test", "krm", "glob")
+	manifest := makeManifest([]string{filepath.Join(dir, "resources", "*.enc.yaml")}, `secretFrom:
+- metadata:
+    name: mysecret
+  files:
+  - `+filepath.Join(dir, "config"))
+
+	got, _, err := generate(context.Background(), manifest, "")
+	if err != nil {
+		t.Fatalf("generate failed: %v", err)
+	}
+
+	docs := strings.Split(got, "---")
+	if len(docs) != 3 {
+		t.Errorf("expected 3 documents, got %d:\n%s", len(docs), got)
+	}
+	for _, want := range []string{"name: mysecret-A", "name: mysecret-B", "credentials.enc.yaml: |", "settings.enc.yaml: |"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output missing %q:\n%s", want, got)
+		}
+	}
+	if strings.Index(got, "mysecret-A") > strings.Index(got, "mysecret-B") {
+		t.Errorf("glob matches are not in sorted order:\n%s", got)
+	}
+}
+
+func TestResolvePath(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, "secret.enc.yaml", "config/a.yaml")
+
+	tests := []struct {
+		name string
+		dir  string
+		path string
+		want string
+	}{
+		{name: "no dir", dir: "", path: "secret.enc.yaml", want: "secret.enc.yaml"},
+		{name: "relative file", dir: dir, path: "./secret.enc.yaml", want: filepath.Join(dir, "secret.enc.yaml")},
+		{name: "relative directory", dir: dir, path: "config", want: filepath.Join(dir, "config")},
+		{name: "relative glob", dir: dir, path: "config/*.yaml", want: filepath.Join(dir, "config", "*.yaml")},
+		{name: "absolute", dir: dir, path: "/etc/secret.enc.yaml", want: "/etc/secret.enc.yaml"},
+		{name: "missing falls back to working directory", dir: dir, path: "missing.enc.yaml", want: "missing.enc.yaml"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := resolvePath(osFS{}, tc.dir, tc.path); got != tc.want {
+				t.Errorf("resolvePath(%q, %q) = %q, want %q", tc.dir, tc.path, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestManifestDir(t *testing.T) {
+	tests := []struct {
+		annotations string
+		want        string
+	}{
+		{annotations: "", want: ""},
+		{annotations: "config.kubernetes.io/path: secrets/generator.yaml", want: "secrets"},
+		{annotations: "internal.config.kubernetes.io/path: overlays/prod/generator.yaml", want: "overlays/prod"},
+		{annotations: "config.kubernetes.io/path: legacy/generator.yaml\n    internal.config.kubernetes.io/path: internal/generator.yaml", want: "internal"},
+		{annotations: "config.kubernetes.io/path: generator.yaml", want: "."},
+	}
+	for _, tc := range tests {
+		obj, err := fn.ParseKubeObject([]byte("apiVersion: viaduct.ai/v1\nkind: ksops\nmetadata:\n  name: test\n  annotations:\n    " + tc.annotations + "\n"))
+		if err != nil {
+			t.Fatalf("failed to parse object: %v", err)
+		}
+		if got := manifestDir(obj); got != tc.want {
+			t.Errorf("manifestDir() with %q = %q, want %q", tc.annotations, got, tc.want)
+		}
+	}
+}
+
+func TestKRMResolvesPathsAgainstGenerator(t *testing.T) {
+	importTestKey(t)
+
+	// Without the path annotation, ./secret.enc.env would be read from the working directory.
+	rl, err := fn.ParseResourceList([]byte(`apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: viaduct.ai/v1
+  kind: ksops
+  metadata:
+    name: test
+    annotations:
+      config.kubernetes.io/path: test/legacy/envs/generate-resources.yaml
+  secretFrom:
+  - metadata:
+      name: mysecret
+    envs:
+    - ./secret.enc.env
+`))
+	if err != nil {
+		t.Fatalf("failed to parse resource list: %v", err)
+	}
+	if ok, err := krm(rl); !ok || err != nil {
+		t.Fatalf("krm failed: %v", err)
+	}
+	if len(rl.Items) != 1 || rl.Items[0].GetName() != "mysecret" {
+		t.Fatalf("unexpected items: %v", rl.Items)
+	}
+}
+
+func TestFileLoaderRestrictions(t *testing.T) {
+	tmp := t.TempDir()
+	writeFiles(t, tmp, "root/secret.enc.yaml", "root/config/a.yaml", "outside/other.enc.yaml")
+	root := filepath.Join(tmp, "root")
+	if err := os.Symlink(filepath.Join(tmp, "outside", "other.enc.yaml"), filepath.Join(root, "link.enc.yaml")); err != nil {
+		t.Fatalf("failed to create symlink: %v", err)
+	}
+	if err := os.Symlink(filepath.Join(tmp, "outside"), filepath.Join(root, "linkdir")); err != nil {
+		t.Fatalf("failed to create symlink: %v", err)
+	}
+	t.Chdir(root)
+
+	tests := []struct {
+		path    string
+		wantErr bool
+	}{
+		{path: "secret.enc.yaml"},
+		{path: "./config"},
+		{path: "config/../secret.enc.yaml"},
+		// Absolute paths are allowed within the root.
+		{path: filepath.Join(root, "secret.enc.yaml")},
+		{path: "missing.enc.yaml"},
+		{path: "../outside/other.enc.yaml", wantErr: true},
+		{path: filepath.Join(tmp, "outside", "other.enc.yaml"), wantErr: true},
+		{path: "../missing.enc.yaml", wantErr: true},
+		{path: "link.enc.yaml", wantErr: true},
+		{path: "linkdir", wantErr: true},
+		{path: "*.enc.yaml", wantErr: true},
+	}
+
+	rootOnly, err := newFileLoader(osFS{}, "", "", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	none, err := newFileLoader(osFS{}, "", "", loadRestrictionsNone)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, tc := range tests {
+		t.Run(tc.path, func(t *testing.T) {
+			_, err := rootOnly.expandPath(tc.path)
+			if tc.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "outside of the kustomization root") {
+					t.Errorf("expected a load restriction error, got %v", err)
+				}
+			} else if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if _, err := none.expandPath(tc.path); err != nil {
+				t.Errorf("unexpected error with %s: %v", loadRestrictionsNone, err)
+			}
+		})
+	}
+}
+
+func TestNewFileLoaderInvalidRestrictor(t *testing.T) {
+	if _, err := newFileLoader(osFS{}, "", "", "LoadRestrictionsSome"); err == nil {
+		t.Fatal("expected error for an invalid load restrictor")
+	}
+}
+
+func TestGenerateLoadRestrictor(t *testing.T) {
+	importTestKey(t)
+
+	file := testFixturePath(t, "test", "legacy", "envs", "secret.enc.env")
+	secretFrom := `secretFrom:
+- metadata:
+    name: mysecret
+  envs:
+  - ` + file
+	t.Chdir(testFixturePath(t, "test", "krm"))
+
+	if _, _, err := generate(context.Background(), makeManifest(nil, secretFrom), ""); err == nil || !strings.Contains(err.Error(), "outside of the kustomization root") {
+		t.Fatalf("expected a load restriction error, got %v", err)
+	}
+
+	// The manifest cannot lift the restriction unless the operator does.
+	optOut := makeManifest(nil, "loadRestrictor: LoadRestrictionsNone\n"+secretFrom)
+	if _, _, err := generate(context.Background(), optOut, ""); err == nil || !strings.Contains(err.Error(), "must be allowed by the operator") {
+		t.Fatalf("expected %s to be rejected, got %v", loadRestrictionsNone, err)
+	}
+	if _, _, err := generate(context.Background(), optOut, "", WithLoadRestrictor(loadRestrictionsNone)); err != nil {
+		t.Fatalf("generate failed with %s: %v", loadRestrictionsNone, err)
+	}
+
+	if _, _, err := generate(context.Background(), optOut, "", WithLoadRestrictor(loadRestrictionsRootOnly)); err == nil {
+		t.Fatal("WithLoadRestrictor should take precedence over the manifest")
+	}
+}
@@ -0,0 +1,211 @@
+// Copyright 2026 viaduct.ai
+// SPDX-License-Identifier: Apache-2.0
+
+package ksops
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/GoogleContainerTools/kpt-functions-sdk/go/fn"
+	goyaml "go.yaml.in/yaml/v3"
+)
+
+// placeholderPrefix starts a placeholder, <ksops:path#selector>, in a resource.
+const placeholderPrefix = "<ksops:"
+
+var placeholderPattern = regexp.MustCompile(`<ksops:([^<>#\s]+)(?:#([^<>]+))?>`)
+
+// placeholder is a reference to a value in an encrypted file.
+type placeholder struct {
+	// file is the resolved path of the encrypted file.
+	file     string
+	selector string
+}
+
+// placeholders are the <ksops:path#selector> placeholders found in the string
+// values of a list of resources. The same text refers to different files in
+// resources of different directories, so placeholders are resolved per
+// resource.
+type placeholders struct {
+	resources []*resource
+	// docs are the parsed resources, nil for those without placeholders.
+	docs []*goyaml.Node
+	// texts maps the text of the placeholders of each resource to the value
+	// it refers to.
+	texts []map[string]placeholder
+	// refs maps each referenced value to the first resource referencing it.
+	refs map[placeholder]*fn.ResourceRef
+}
+
+// findPlaceholders parses the placeholders of resources from their YAML, only
+// for those containing one, and resolves the paths of the files they reference
+// in fsys, relative to root, the kustomization root.
+func findPlaceholders(resources []*resource, fsys fs.FS, root, restrictor string) (*placeholders, error) {
+	ph := &placeholders{
+		resources: resources,
+		docs:      make([]*goyaml.Node, len(resources)),
+		texts:     make([]map[string]placeholder, len(resources)),
+		refs:      make(map[placeholder]*fn.ResourceRef),
+	}
+	for i, r := range resources {
+		if !bytes.Contains(r.yaml, []byte(placeholderPrefix)) {
+			continue
+		}
+		obj := r.obj
+		var doc goyaml.Node
+		if err := goyaml.Unmarshal(r.yaml, &doc); err != nil {
+			return nil, fmt.Errorf("error parsing %s %q: %w", obj.GetKind(), obj.GetName(), err)
+		}
+		ph.docs[i] = &doc
+		texts := make(map[string]placeholder)
+		ph.texts[i] = texts
+
+		loader, err := newFileLoader(fsys, root, manifestDir(obj), restrictor)
+		if err != nil {
+			return nil, err
+		}
+		err = walkStrings(&doc, func(value string) (string, error) {
+			for _, m := range placeholderPattern.FindAllStringSubmatch(value, -1) {
+				if _, ok := texts[m[0]]; ok {
+					continue
+				}
+				files, err := loader.expandPath(m[1])
+				if err != nil {
+					return "", err
+				}
+				if len(files) != 1 {
+					return "", fmt.Errorf("placeholder %s matches %d files", m[0], len(files))
+				}
+				ref := placeholder{file: files[0], selector: m[2]}
+				texts[m[0]] = ref
+				if _, ok := ph.refs[ref]; !ok {
+					ph.refs[ref] = resourceRef(obj)
+				}
+			}
+			if rest := placeholderPattern.ReplaceAllString(value, ""); strings.Contains(rest, placeholderPrefix) {
+				return "", fmt.Errorf("invalid placeholder in %q", value)
+			}
+			return value, nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error resolving placeholders in %s %q: %w", obj.GetKind(), obj.GetName(), err)
+		}
+	}
+	return ph, nil
+}
+
+// plan adds the files referenced by the placeholders to p, in a stable order.
+func (ph *placeholders) plan(p *decryptPlan) error {
+	refs := make([]placeholder, 0, len(ph.refs))
+	for ref := range ph.refs {
+		refs = append(refs, ref)
+	}
+	sort.Slice(refs, func(i, j int) bool {
+		if refs[i].file != refs[j].file {
+			return refs[i].file < refs[j].file
+		}
+		return refs[i].selector < refs[j].selector
+	})
+	for _, ref := range refs {
+		if err := p.add(ref.file, fileRef{origin: "referenced by a placeholder", resource: ph.refs[ref]}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// substitute returns the objects of the resources with their placeholders
+// replaced by the selected values of the files decrypted by p.
+func (ph *placeholders) substitute(p *decryptPlan) (fn.KubeObjects, error) {
+	substituted := make(fn.KubeObjects, len(ph.resources))
+	for i, r := range ph.resources {
+		substituted[i] = r.obj
+	}
+	if len(ph.refs) == 0 {
+		return substituted, nil
+	}
+
+	values := make(map[placeholder]string, len(ph.refs))
+	resolve := func(text string, ref placeholder) (string, error) {
+		if v, ok := values[ref]; ok {
+			return v, nil
+		}
+		data := p.data(ref.file)
+		v := string(data)
+		if ref.selector != "" {
+			var err error
+			if v, err = selectValue(data, p.format(ref.file), ref.selector); err != nil {
+				return "", fmt.Errorf("error resolving placeholder %s: %w", text, err)
+			}
+		}
+		values[ref] = v
+		return v, nil
+	}
+
+	for i, r := range ph.resources {
+		if ph.docs[i] == nil {
+			continue
+		}
+		obj := r.obj
+		err := walkStrings(ph.docs[i], func(value string) (string, error) {
+			var err error
+			value = placeholderPattern.ReplaceAllStringFunc(value, func(text string) string {
+				v, rerr := resolve(text, ph.texts[i][text])
+				if rerr != nil && err == nil {
+					err = rerr
+				}
+				return v
+			})
+			return value, err
+		})
+		if err != nil {
+			return nil, err
+		}
+		out, err := marshalYAMLNode(ph.docs[i])
+		if err != nil {
+			return nil, fmt.Errorf("error marshalling %s %q: %w", obj.GetKind(), obj.GetName(), err)
+		}
+		substituted[i], err = fn.ParseKubeObject(out)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing %s %q: %w", obj.GetKind(), obj.GetName(), err)
+		}
+		if err := restoreAnnotations(substituted[i], r.annotations); err != nil {
+			return nil, err
+		}
+	}
+	return substituted, nil
+}
+
+// walkStrings calls fn with every string scalar value in node, mapping keys
+// excluded, and replaces the value with the one fn returns.
+func walkStrings(node *goyaml.Node, fn func(string) (string, error)) error {
+	switch node.Kind {
+	case goyaml.DocumentNode, goyaml.SequenceNode:
+		for _, child := range node.Content {
+			if err := walkStrings(child, fn); err != nil {
+				return err
+			}
+		}
+	case goyaml.MappingNode:
+		for i := 1; i < len(node.Content); i += 2 {
+			if err := walkStrings(node.Content[i], fn); err != nil {
+				return err
+			}
+		}
+	case goyaml.ScalarNode:
+		if node.Tag != "!!str" || !strings.Contains(node.Value, placeholderPrefix) {
+			return nil
+		}
+		v, err := fn(node.Value)
+		if err != nil {
+			return err
+		}
+		node.Value = v
+	}
+	return nil
+}
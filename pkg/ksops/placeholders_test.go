@@ -0,0 +1,134 @@
+// Copyright 2026 viaduct.ai
+// SPDX-License-Identifier: Apache-2.0
+
+package ksops
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/GoogleContainerTools/kpt-functions-sdk/go/fn"
+)
+
+// placeholderObject returns a ConfigMap with value under data.value, read from
+// the placeholders fixture directory.
+func placeholderObject(t *testing.T, value string) *fn.KubeObject {
+	t.Helper()
+	obj, err := fn.ParseKubeObject([]byte(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: app-config
+  annotations:
+    config.kubernetes.io/path: test/krm/placeholders/configmap.yaml
+data:
+  value: "` + value + `"
+`))
+	if err != nil {
+		t.Fatalf("failed to parse object: %v", err)
+	}
+	return obj
+}
+
+// substituteTestPlaceholders finds the placeholders of objs, decrypts the
+// files they reference and substitutes them, like Process does.
+func substituteTestPlaceholders(t *testing.T, objs fn.KubeObjects) (fn.KubeObjects, error) {
+	t.Helper()
+	g := newTestDecryptGroup(t)
+	resources := make([]*resource, len(objs))
+	for i, obj := range objs {
+		r, err := newResource(obj)
+		if err != nil {
+			return nil, err
+		}
+		resources[i] = r
+	}
+	ph, err := findPlaceholders(resources, g.fsys, "", "")
+	if err != nil {
+		return nil, err
+	}
+	p := newDecryptPlan()
+	ph.plan(p)
+	if err := p.decrypt(g); err != nil {
+		return nil, err
+	}
+	return ph.substitute(p)
+}
+
+func TestSubstitutePlaceholders(t *testing.T) {
+	importTestKey(t)
+
+	tests := []struct {
+		value   string
+		want    string
+		wantErr string
+	}{
+		{value: "plain", want: "plain"},
+		{value: "<ksops:secrets.enc.yaml#.api.token>", want: "abc123"},
+		{
+			value: "<ksops:secrets.enc.yaml#.database.host>:<ksops:secrets.enc.yaml#.database.port>",
+			want:  "db.internal:5432",
+		},
+		{value: "<ksops:secrets.enc.yaml#.database.missing>", wantErr: ".missing not found"},
+		{value: "<ksops:missing.enc.yaml#.token>", wantErr: "missing.enc.yaml"},
+		{value: "<ksops:>", wantErr: "invalid placeholder"},
+		{value: "<ksops:secrets.enc.yaml#.api.token", wantErr: "invalid placeholder"},
+		{value: "<ksops:../../../../secrets.enc.yaml>", wantErr: "outside of the kustomization root"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.value, func(t *testing.T) {
+			objs, err := substituteTestPlaceholders(t, fn.KubeObjects{placeholderObject(t, tc.value)})
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := objs[0].GetMap("data").GetString("value"); got != tc.want {
+				t.Errorf("value = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSubstitutePlaceholdersSkipsKeysAndNonStrings(t *testing.T) {
+	obj, err := fn.ParseKubeObject([]byte(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: app-config
+data:
+  <ksops:secrets.enc.yaml>: key
+  # <ksops:secrets.enc.yaml> in a comment
+  replicas: 3
+`))
+	if err != nil {
+		t.Fatalf("failed to parse object: %v", err)
+	}
+	objs, err := substituteTestPlaceholders(t, fn.KubeObjects{obj})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := objs[0].GetMap("data").GetString("<ksops:secrets.enc.yaml>"); got != "key" {
+		t.Errorf("mapping key should not be substituted:\n%s", objs[0])
+	}
+}
+
+func TestKRMPlaceholders(t *testing.T) {
+	importTestKey(t)
+
+	rl := &fn.ResourceList{Items: fn.KubeObjects{
+		placeholderObject(t, "<ksops:secrets.enc.yaml#.database.password>"),
+		placeholderObject(t, "<ksops:secrets.enc.yaml#.api.token>"),
+	}}
+	if ok, err := krm(rl); !ok || err != nil {
+		t.Fatalf("krm failed: %v", err)
+	}
+	for i, want := range []string{"s3cr3t", "abc123"} {
+		if got := rl.Items[i].GetMap("data").GetString("value"); got != want {
+			t.Errorf("item %d value = %q, want %q", i, got, want)
+		}
+	}
+}
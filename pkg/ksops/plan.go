@@ -0,0 +1,195 @@
+// Copyright 2026 viaduct.ai
+// SPDX-License-Identifier: Apache-2.0
+
+package ksops
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+
+	"github.com/GoogleContainerTools/kpt-functions-sdk/go/fn"
+	"github.com/getsops/sops/v3/cmd/sops/formats"
+)
+
+// decryptPlan collects the encrypted files referenced by ksops manifests and
+// placeholders, along with the inline encryptedLiterals blocks of manifests,
+// so that everything is decrypted once, in a single concurrent pass, before
+// the outputs are assembled.
+type decryptPlan struct {
+	files []*plannedFile
+	// byPath indexes files by their absolute path.
+	byPath map[string]*plannedFile
+	// literals are the encryptedLiterals blocks, which are not files.
+	literals []*plannedFile
+}
+
+// plannedFile is an encrypted file of a decryptPlan. Errors are reported
+// against the first reference to it.
+type plannedFile struct {
+	// path is "" for an encryptedLiterals block.
+	path string
+	ref  fileRef
+	// formatOrigin is the origin of the reference setting ref.format, if any.
+	formatOrigin string
+	// encrypted is the content of the file, read before it is decrypted.
+	encrypted []byte
+	data      []byte
+	// format is the SOPS format the file was decrypted as.
+	format    formats.Format
+	decrypted bool
+}
+
+// fileRef is a reference to an encrypted file.
+type fileRef struct {
+	// field is the field of the ksops manifest the file is listed at, such as
+	// secretFrom[2].envs[0].
+	field string
+	// origin describes the reference in errors, such as "from secretFrom.Envs",
+	// or names the field of an encryptedLiterals block.
+	origin string
+	// format is the SOPS format set for the file, if any.
+	format string
+	// resource is the resource holding the reference, if any.
+	resource *fn.ResourceRef
+}
+
+func newDecryptPlan() *decryptPlan {
+	return &decryptPlan{byPath: make(map[string]*plannedFile)}
+}
+
+// add adds a file to the plan, unless it is already planned. A file is
+// decrypted in the format set by its references, if any. References setting
+// different formats conflict, as the file is decrypted once.
+func (p *decryptPlan) add(path string, ref fileRef) error {
+	key := planKey(path)
+	if f, ok := p.byPath[key]; ok {
+		switch {
+		case ref.format == "" || ref.format == f.ref.format:
+		case f.ref.format == "":
+			f.ref.format, f.formatOrigin = ref.format, ref.origin
+		default:
+			return &fieldError{
+				field:    ref.field,
+				file:     path,
+				resource: ref.resource,
+				err:      fmt.Errorf("file %q %s has format %s, but %s %s", path, ref.origin, ref.format, f.ref.format, f.formatOrigin),
+			}
+		}
+		return nil
+	}
+	f := &plannedFile{path: path, ref: ref, formatOrigin: ref.origin}
+	p.files = append(p.files, f)
+	p.byPath[key] = f
+	return nil
+}
+
+// addLiterals adds an encryptedLiterals block, in the YAML output of SOPS, to
+// the plan. Its decrypted content is in the returned plannedFile once the plan
+// is decrypted.
+func (p *decryptPlan) addLiterals(block []byte, ref fileRef) *plannedFile {
+	f := &plannedFile{ref: ref, encrypted: block, format: formats.Yaml}
+	p.literals = append(p.literals, f)
+	return f
+}
+
+// decrypt decrypts every planned file and block that has not been decrypted
+// yet, failing with the errors of all of them when errors are aggregated. Files
+// are read first, so that each one is scheduled into the pools of its key
+// providers, and decrypted in the override format of its reference if set, or
+// else in the format of its extension or content.
+func (p *decryptPlan) decrypt(g *decryptGroup) error {
+	var pending []*plannedFile
+	var failures []error
+	for _, f := range p.files {
+		if f.decrypted {
+			continue
+		}
+		b, err := fs.ReadFile(g.fsys, f.path)
+		if err != nil {
+			err = f.error(fmt.Errorf("error reading %q: %w", f.path, err))
+			if !g.aggregate {
+				return err
+			}
+			failures = append(failures, err)
+			continue
+		}
+		f.encrypted, f.format = b, sopsFormat(f.path, f.ref.format, b)
+		pending = append(pending, f)
+	}
+	for _, f := range p.literals {
+		if !f.decrypted {
+			pending = append(pending, f)
+		}
+	}
+
+	decrypted, err := decryptAll(g, pending, func(f *plannedFile) []string {
+		return g.keyTypes(f.encrypted, f.format)
+	}, func(ctx context.Context, f *plannedFile) ([]byte, error) {
+		data, err := g.decryptData(ctx, f.encrypted, f.format)
+		if f.path == "" {
+			if err != nil {
+				return nil, f.error(fmt.Errorf("trouble decrypting encryptedLiterals: %w", err))
+			}
+			g.log.Debug("decrypted encryptedLiterals", "field", f.ref.field)
+			return data, nil
+		}
+		if err != nil {
+			return nil, f.error(fmt.Errorf("trouble decrypting file: %w", err))
+		}
+		g.log.Debug("decrypted file", "path", f.path, "format", f.format)
+		return data, nil
+	})
+	if g.aggregate {
+		err = newDecryptionErrors(append(failures, err)...)
+	}
+	if err != nil {
+		return err
+	}
+	for i, f := range pending {
+		f.data, f.encrypted, f.decrypted = decrypted[i], nil, true
+	}
+	return nil
+}
+
+// error reports an error decrypting a planned file against its first
+// reference.
+func (f *plannedFile) error(err error) error {
+	if f.path == "" {
+		err = fmt.Errorf("error decrypting %s: %w", f.ref.origin, err)
+	} else {
+		err = fmt.Errorf("error decrypting file %q %s: %w", f.path, f.ref.origin, err)
+	}
+	return &fieldError{
+		field:    f.ref.field,
+		file:     f.path,
+		resource: f.ref.resource,
+		err:      err,
+	}
+}
+
+// data returns the decrypted content of a planned file.
+func (p *decryptPlan) data(path string) []byte {
+	if f, ok := p.byPath[planKey(path)]; ok {
+		return f.data
+	}
+	return nil
+}
+
+// format returns the SOPS format a planned file was decrypted as.
+func (p *decryptPlan) format(path string) formats.Format {
+	if f, ok := p.byPath[planKey(path)]; ok {
+		return f.format
+	}
+	return formats.FormatForPath(path)
+}
+
+// planKey identifies a file by its absolute path, so that the same file
+// referenced through different relative paths is decrypted once.
+func planKey(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return filepath.Clean(path)
+}
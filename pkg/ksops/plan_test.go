@@ -0,0 +1,257 @@
+// Copyright 2026 viaduct.ai
+// SPDX-License-Identifier: Apache-2.0
+
+package ksops
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/GoogleContainerTools/kpt-functions-sdk/go/fn"
+	"github.com/getsops/sops/v3/cmd/sops/formats"
+)
+
+// countingDecryptor decrypts with SOPS, counting the decryptions.
+type countingDecryptor struct {
+	calls atomic.Int32
+}
+
+func (d *countingDecryptor) Decrypt(ctx context.Context, data []byte, format formats.Format) ([]byte, error) {
+	d.calls.Add(1)
+	return sopsDecryptor{}.Decrypt(ctx, data, format)
+}
+
+func TestDecryptPlanDeduplicates(t *testing.T) {
+	importTestKey(t)
+	d := &countingDecryptor{}
+
+	abs := testFixturePath(t, "test", "legacy", "single", "secret.enc.yaml")
+	rel := filepath.Join("test", "legacy", "envs", "..", "single", "secret.enc.yaml")
+
+	p := newDecryptPlan()
+	for path, ref := range map[string]fileRef{
+		abs: {field: "files[0]", origin: "from manifest.Files"},
+		rel: {field: "secretFrom[0].files[0]", origin: "from secretFrom.Files"},
+	} {
+		if err := p.add(path, ref); err != nil {
+			t.Fatalf("add failed: %v", err)
+		}
+	}
+	if len(p.files) != 1 {
+		t.Fatalf("expected 1 planned file, got %d", len(p.files))
+	}
+	if err := p.decrypt(newTestDecryptGroup(t, WithDecryptor(d))); err != nil {
+		t.Fatalf("decrypt failed: %v", err)
+	}
+	// Decrypting again is a no-op once every file is decrypted.
+	if err := p.decrypt(newTestDecryptGroup(t, WithDecryptor(d))); err != nil {
+		t.Fatalf("decrypt failed: %v", err)
+	}
+	if got := d.calls.Load(); got != 1 {
+		t.Errorf("expected 1 decryption, got %d", got)
+	}
+	if data := p.data(rel); !strings.Contains(string(data), "name: mysecret") || string(data) != string(p.data(abs)) {
+		t.Errorf("unexpected decrypted data: %q", data)
+	}
+}
+
+func TestDecryptPlanErrorAttribution(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing.enc.yaml")
+	resource := &fn.ResourceRef{Kind: "ksops", Name: "first"}
+
+	p := newDecryptPlan()
+	if err := p.add(missing, fileRef{field: "secretFrom[1].envs[0]", origin: "from secretFrom.Envs", resource: resource}); err != nil {
+		t.Fatalf("add failed: %v", err)
+	}
+	if err := p.add(missing, fileRef{field: "files[0]", origin: "from manifest.Files"}); err != nil {
+		t.Fatalf("add failed: %v", err)
+	}
+	err := p.decrypt(newTestDecryptGroup(t))
+
+	var fe *fieldError
+	if !errors.As(err, &fe) {
+		t.Fatalf("expected a fieldError, got %v", err)
+	}
+	if fe.field != "secretFrom[1].envs[0]" || fe.file != missing || fe.resource != resource {
+		t.Errorf("error should be reported against the first reference, got %+v", fe)
+	}
+	if !strings.Contains(err.Error(), "from secretFrom.Envs") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestDecryptPlanFormats(t *testing.T) {
+	resource := &fn.ResourceRef{Kind: "ksops", Name: "first"}
+
+	p := newDecryptPlan()
+	for _, ref := range []fileRef{
+		{origin: "referenced by a placeholder"},
+		{field: "files[0]", origin: "from manifest.Files", format: "yaml"},
+		{field: "secretFrom[0].envs[0]", origin: "from secretFrom.Envs"},
+	} {
+		if err := p.add("secret.enc", ref); err != nil {
+			t.Fatalf("add failed: %v", err)
+		}
+	}
+	// A reference without a format takes the format of one that sets it.
+	if got := p.files[0].ref.format; got != "yaml" {
+		t.Errorf("expected the file to be decrypted as yaml, got %q", got)
+	}
+
+	err := p.add("secret.enc", fileRef{field: "secretFrom[1].envs[0]", origin: "from secretFrom.Envs", format: "json", resource: resource})
+	var fe *fieldError
+	if !errors.As(err, &fe) || fe.field != "secretFrom[1].envs[0]" || fe.resource != resource {
+		t.Fatalf("expected a conflict at secretFrom[1].envs[0], got %v", err)
+	}
+	for _, want := range []string{"from secretFrom.Envs has format json", "yaml from manifest.Files"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error should contain %q: %v", want, err)
+		}
+	}
+}
+
+func TestGenerateDecryptsEachFileOnce(t *testing.T) {
+	importTestKey(t)
+	d := &countingDecryptor{}
+
+	secret := testFixturePath(t, "test", "legacy", "single", "secret.enc.yaml")
+	env := testFixturePath(t, "test", "legacy", "envs", "secret.enc.env")
+	manifest := makeManifest([]string{secret}, `secretFrom:
+- metadata:
+    name: first
+  files:
+  - secret.yaml=`+secret+`
+  envs:
+  - `+env+`
+- metadata:
+    name: second
+  binaryFiles:
+  - secret.yaml=`+secret+`
+configMapFrom:
+- metadata:
+    name: config
+  envs:
+  - `+env)
+
+	out, _, err := generate(context.Background(), manifest, "", WithLoadRestrictor(loadRestrictionsNone), WithDecryptor(d))
+	if err != nil {
+		t.Fatalf("generate failed: %v", err)
+	}
+	if got := d.calls.Load(); got != 2 {
+		t.Errorf("expected 2 decryptions, one per file, got %d", got)
+	}
+	objs, err := fn.ParseKubeObjects([]byte(out))
+	if err != nil {
+		t.Fatalf("failed to parse output: %v", err)
+	}
+	if len(objs) != 4 {
+		t.Errorf("expected 4 resources, got %d:\n%s", len(objs), out)
+	}
+}
+
+func TestKRMDecryptsAcrossGenerators(t *testing.T) {
+	importTestKey(t)
+	d := &countingDecryptor{}
+
+	generator := func(name, spec string) string {
+		return `- apiVersion: viaduct.ai/v1
+  kind: ksops
+  metadata:
+    name: ` + name + `
+    annotations:
+      config.kubernetes.io/path: test/legacy/single/generate-resources.yaml
+` + spec
+	}
+	first := `  files:
+  - ./secret.enc.yaml
+`
+	rl, err := fn.ParseResourceList([]byte(`apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+` + generator("first", first) + generator("second", `  secretFrom:
+  - metadata:
+      name: copy
+    files:
+    - secret.yaml=./secret.enc.yaml
+`) + `functionConfig:
+  apiVersion: viaduct.ai/v1
+  kind: ksops
+  metadata:
+    name: first
+    annotations:
+      config.kubernetes.io/function: |
+        exec:
+          path: ksops
+` + first))
+	if err != nil {
+		t.Fatalf("failed to parse resource list: %v", err)
+	}
+
+	if ok, err := krm(rl, WithDecryptor(d)); !ok || err != nil {
+		t.Fatalf("krm failed: %v", err)
+	}
+	if got := d.calls.Load(); got != 1 {
+		t.Errorf("expected 1 decryption across generators, got %d", got)
+	}
+	var names []string
+	for _, obj := range rl.Items {
+		names = append(names, obj.GetName())
+	}
+	if strings.Join(names, ",") != "mysecret,copy" {
+		t.Errorf("unexpected items: %v", names)
+	}
+}
+
+func TestKRMReportsPlanErrorsPerGenerator(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "generate-resources.yaml")
+	if err := os.WriteFile(path, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	rl, err := fn.ParseResourceList([]byte(`apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: viaduct.ai/v1
+  kind: ksops
+  metadata:
+    name: broken
+    annotations:
+      config.kubernetes.io/path: ` + path + `
+  loadRestrictor: sometimes
+  files:
+  - ./broken.enc.yaml
+- apiVersion: viaduct.ai/v1
+  kind: ksops
+  metadata:
+    name: missing
+    annotations:
+      config.kubernetes.io/path: ` + path + `
+  files:
+  - ./missing.enc.yaml
+`))
+	if err != nil {
+		t.Fatalf("failed to parse resource list: %v", err)
+	}
+
+	if ok, err := krm(rl); ok || err == nil {
+		t.Fatal("expected krm to fail")
+	}
+	byName := make(map[string]*fn.Result)
+	for _, r := range rl.Results {
+		if r.ResourceRef != nil {
+			byName[r.ResourceRef.Name] = r
+		}
+	}
+	if r := byName["broken"]; r == nil || r.Field == nil || r.Field.Path != "loadRestrictor" {
+		t.Errorf("expected an error for the broken generator, got %v", rl.Results)
+	}
+	if r := byName["missing"]; r == nil || r.Field == nil || r.Field.Path != "files[0]" {
+		t.Errorf("expected an error for the missing file, got %v", rl.Results)
+	}
+}
@@ -0,0 +1,145 @@
+// Copyright 2026 viaduct.ai
+// SPDX-License-Identifier: Apache-2.0
+
+package ksops
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/getsops/sops/v3/cmd/sops/common"
+	"github.com/getsops/sops/v3/cmd/sops/formats"
+	"github.com/getsops/sops/v3/config"
+	"github.com/getsops/sops/v3/keys"
+	"golang.org/x/time/rate"
+)
+
+// keyProviderTypes are the SOPS master key types that can be limited.
+var keyProviderTypes = []string{"age", "pgp", "kms", "gcp_kms", "azure_kv", "hc_vault", "hckms"}
+
+// providerPool limits the decryptions using a key provider. A nil slots or
+// limiter is unlimited.
+type providerPool struct {
+	slots   chan struct{}
+	limiter *rate.Limiter
+}
+
+// providerPools are the pools of the key providers that are limited.
+type providerPools map[string]*providerPool
+
+// providerLimit limits the decryptions of a key provider to concurrency
+// concurrent decryptions and perSecond decryptions per second. 0 leaves either
+// unlimited.
+type providerLimit struct {
+	concurrency int
+	perSecond   float64
+}
+
+// newProviderPools returns the pools of the key providers that are limited.
+func newProviderPools(limits map[string]providerLimit) (providerPools, error) {
+	pools := make(providerPools)
+	for provider, limit := range limits {
+		if !slices.Contains(keyProviderTypes, provider) {
+			return nil, fmt.Errorf("invalid key provider %q: must be one of %s", provider, strings.Join(keyProviderTypes, ", "))
+		}
+		if limit.concurrency < 0 || limit.perSecond < 0 {
+			return nil, fmt.Errorf("invalid %s limit: must not be negative", provider)
+		}
+		var pool providerPool
+		if limit.concurrency > 0 {
+			pool.slots = make(chan struct{}, limit.concurrency)
+		}
+		if limit.perSecond > 0 {
+			pool.limiter = rate.NewLimiter(rate.Limit(limit.perSecond), 1)
+		}
+		if pool.slots != nil || pool.limiter != nil {
+			pools[provider] = &pool
+		}
+	}
+	return pools, nil
+}
+
+// acquire waits for a slot and a token in the pool of each provider, in a fixed
+// order, and returns the function releasing the slots.
+func (p providerPools) acquire(ctx context.Context, providers []string) (func(), error) {
+	var held []*providerPool
+	release := func() {
+		for _, pool := range held {
+			<-pool.slots
+		}
+	}
+	for _, provider := range providers {
+		pool, ok := p[provider]
+		if !ok {
+			continue
+		}
+		if pool.slots != nil {
+			select {
+			case pool.slots <- struct{}{}:
+				held = append(held, pool)
+			case <-ctx.Done():
+				release()
+				return nil, fmt.Errorf("waiting for a %s decryption slot: %w", provider, context.Cause(ctx))
+			}
+		}
+		if pool.limiter != nil {
+			if err := pool.limiter.Wait(ctx); err != nil {
+				release()
+				if ctx.Err() != nil {
+					err = context.Cause(ctx)
+				}
+				return nil, fmt.Errorf("waiting for the %s rate limit: %w", provider, err)
+			}
+		}
+	}
+	return release, nil
+}
+
+// keyTypes returns the key provider types of encrypted content to schedule it
+// into the pools of the group, nil if there are none. Content with keys of
+// several providers uses a slot of each, as SOPS may try any of them.
+func (g *decryptGroup) keyTypes(b []byte, format formats.Format) []string {
+	if len(g.pools) == 0 {
+		return nil
+	}
+	return keyTypes(b, format)
+}
+
+// masterKeys returns the master keys in the sops metadata of encrypted content,
+// or nil if it cannot be parsed.
+func masterKeys(b []byte, format formats.Format) []keys.MasterKey {
+	tree, err := common.StoreForFormat(format, config.NewStoresConfig()).LoadEncryptedFile(b)
+	if err != nil {
+		return nil
+	}
+	var masterKeys []keys.MasterKey
+	for _, group := range tree.Metadata.KeyGroups {
+		masterKeys = append(masterKeys, group...)
+	}
+	return masterKeys
+}
+
+// keyTypes returns the sorted key provider types of encrypted content.
+func keyTypes(b []byte, format formats.Format) []string {
+	var types []string
+	for _, key := range masterKeys(b, format) {
+		types = append(types, key.TypeToIdentifier())
+	}
+	slices.Sort(types)
+	return slices.Compact(types)
+}
+
+// keyProviders describes the master keys of SOPS encrypted content, such as
+// pgp FBC7B9E2A4F9289AC0C1D4843D16CEE4A27381B4.
+func keyProviders(b []byte, format formats.Format) string {
+	var providers []string
+	for _, key := range masterKeys(b, format) {
+		providers = append(providers, key.TypeToIdentifier()+" "+key.ToString())
+	}
+	if len(providers) == 0 {
+		return "unknown"
+	}
+	return strings.Join(providers, ", ")
+}
@@ -0,0 +1,200 @@
+// Copyright 2026 viaduct.ai
+// SPDX-License-Identifier: Apache-2.0
+
+package ksops
+
+import (
+	"context"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/getsops/sops/v3/cmd/sops/formats"
+)
+
+func TestKeyProviders(t *testing.T) {
+	b, err := os.ReadFile(testFixturePath(t, "test", "legacy", "single", "secret.enc.yaml"))
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+	if got, want := keyProviders(b, formats.Yaml), "pgp FBC7B9E2A4F9289AC0C1D4843D16CEE4A27381B4"; got != want {
+		t.Errorf("keyProviders() = %q, want %q", got, want)
+	}
+	if got := keyProviders([]byte("plain: yaml\n"), formats.Yaml); got != "unknown" {
+		t.Errorf("keyProviders() = %q, want unknown", got)
+	}
+}
+
+func TestKeyTypes(t *testing.T) {
+	for fixture, want := range map[string][]string{
+		"legacy/single/secret.enc.yaml": {"pgp"},
+		"kms/secret.enc.yaml":           {"kms"},
+	} {
+		b, err := os.ReadFile(testFixturePath(t, append([]string{"test"}, strings.Split(fixture, "/")...)...))
+		if err != nil {
+			t.Fatalf("failed to read fixture: %v", err)
+		}
+		if got := keyTypes(b, formats.Yaml); !slices.Equal(got, want) {
+			t.Errorf("keyTypes(%s) = %v, want %v", fixture, got, want)
+		}
+	}
+}
+
+func TestNewProviderPools(t *testing.T) {
+	t.Run("unlimited by default", func(t *testing.T) {
+		pools, err := newProviderPools(nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(pools) != 0 {
+			t.Errorf("expected no pools, got %v", pools)
+		}
+	})
+
+	t.Run("configured", func(t *testing.T) {
+		pools, err := newProviderPools(map[string]providerLimit{
+			"kms":     {concurrency: 2, perSecond: 5},
+			"gcp_kms": {perSecond: 0.5},
+			"age":     {},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if kms := pools["kms"]; kms == nil || cap(kms.slots) != 2 || kms.limiter.Limit() != 5 {
+			t.Errorf("unexpected kms pool: %+v", kms)
+		}
+		if gcp := pools["gcp_kms"]; gcp == nil || gcp.slots != nil || gcp.limiter.Limit() != 0.5 {
+			t.Errorf("unexpected gcp_kms pool: %+v", gcp)
+		}
+		if _, ok := pools["age"]; ok {
+			t.Error("age should be unlimited")
+		}
+	})
+
+	for name, limits := range map[string]map[string]providerLimit{
+		"unknown provider":     {"vault": {concurrency: 1}},
+		"negative concurrency": {"pgp": {concurrency: -1}},
+		"negative rate":        {"hc_vault": {perSecond: -1}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := newProviderPools(limits); err == nil || !strings.Contains(err.Error(), "invalid") {
+				t.Errorf("expected an error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestProviderPoolsAcquire(t *testing.T) {
+	pools, err := newProviderPools(map[string]providerLimit{"kms": {concurrency: 1}, "age": {perSecond: 20}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	release, err := pools.acquire(context.Background(), []string{"kms"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := pools.acquire(ctx, []string{"kms", "pgp"}); err == nil || !strings.Contains(err.Error(), "kms decryption slot") {
+		t.Errorf("expected to wait for the kms slot, got %v", err)
+	}
+	release()
+	if release, err := pools.acquire(context.Background(), []string{"kms"}); err != nil {
+		t.Errorf("expected the released slot to be available, got %v", err)
+	} else {
+		release()
+	}
+
+	start := time.Now()
+	for range 3 {
+		release, err := pools.acquire(context.Background(), []string{"age"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		release()
+	}
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+		t.Errorf("3 age decryptions at 20/s took %s, expected at least 100ms", elapsed)
+	}
+}
+
+func TestGenerateProviderPools(t *testing.T) {
+	// Track the concurrent decryptions per key provider.
+	var mu sync.Mutex
+	running := make(map[string]int)
+	peak := make(map[string]int)
+	d := DecryptorFunc(func(_ context.Context, b []byte, format formats.Format) ([]byte, error) {
+		provider := strings.Join(keyTypes(b, format), ",")
+		mu.Lock()
+		running[provider]++
+		running["all"]++
+		peak[provider] = max(peak[provider], running[provider])
+		peak["all"] = max(peak["all"], running["all"])
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		running[provider]--
+		running["all"]--
+		mu.Unlock()
+		return []byte("apiVersion: v1\nkind: Secret\nmetadata:\n  name: fake\n"), nil
+	})
+
+	var files []string
+	for _, name := range []string{"secret.enc.yaml", "secret-A.enc.yaml", "secret-B.enc.yaml", "secret-C.enc.yaml"} {
+		files = append(files, testFixturePath(t, "test", "legacy", "multiple", name))
+	}
+	files = append(files, testFixturePath(t, "test", "kms", "secret.enc.yaml"))
+
+	if _, _, err := generate(context.Background(), makeManifest(files), "", WithProviderLimit("pgp", 1, 0), WithDecryptor(d)); err != nil {
+		t.Fatalf("generate failed: %v", err)
+	}
+	if peak["pgp"] != 1 {
+		t.Errorf("expected at most 1 concurrent pgp decryption, got %d", peak["pgp"])
+	}
+	if peak["kms"] != 1 || peak["all"] < 2 {
+		t.Errorf("expected the kms decryption to run alongside the pgp ones, got %v", peak)
+	}
+}
+
+func TestGenerateProviderPoolsQueueing(t *testing.T) {
+	var mu sync.Mutex
+	done := 0
+	kmsFirst := false
+	d := DecryptorFunc(func(ctx context.Context, b []byte, format formats.Format) ([]byte, error) {
+		if slices.Equal(keyTypes(b, format), []string{"kms"}) {
+			mu.Lock()
+			kmsFirst = done == 0
+			mu.Unlock()
+		}
+		select {
+		case <-time.After(40 * time.Millisecond):
+		case <-ctx.Done():
+			return nil, context.Cause(ctx)
+		}
+		mu.Lock()
+		done++
+		mu.Unlock()
+		return []byte("apiVersion: v1\nkind: Secret\nmetadata:\n  name: fake\n"), nil
+	})
+
+	var files []string
+	for _, name := range []string{"secret.enc.yaml", "secret-A.enc.yaml", "secret-B.enc.yaml", "secret-C.enc.yaml"} {
+		files = append(files, testFixturePath(t, "test", "legacy", "multiple", name))
+	}
+	files = append(files, testFixturePath(t, "test", "kms", "secret.enc.yaml"))
+
+	// Files waiting for the pgp pool neither hold a slot of the group, which
+	// would leave the kms file waiting, nor count against the file timeout,
+	// shorter than a decryption and the wait for the one before it.
+	opts := []Option{WithProviderLimit("pgp", 1, 0), WithConcurrency(2), WithFileTimeout(70 * time.Millisecond), WithDecryptor(d)}
+	if _, _, err := generate(context.Background(), makeManifest(files), "", opts...); err != nil {
+		t.Fatalf("generate failed: %v", err)
+	}
+	if !kmsFirst {
+		t.Error("expected the kms decryption to start before the first pgp one is done")
+	}
+}
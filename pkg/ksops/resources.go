@@ -0,0 +1,152 @@
+// Copyright 2026 viaduct.ai
+// SPDX-License-Identifier: Apache-2.0
+
+package ksops
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/GoogleContainerTools/kpt-functions-sdk/go/fn"
+	goyaml "go.yaml.in/yaml/v3"
+)
+
+// parseResources parses the decrypted content of a files entry into KRM
+// objects. Every document must be an object, or a kind: List whose items are
+// expanded, and every object must be valid. Empty documents are skipped, and
+// errors name the zero-based index of the document.
+func parseResources(data []byte) (fn.KubeObjects, error) {
+	var objs fn.KubeObjects
+	dec := goyaml.NewDecoder(bytes.NewReader(data))
+	for i := 0; ; i++ {
+		var doc goyaml.Node
+		err := dec.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			return objs, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("document %d: %w", i, err)
+		}
+		if len(doc.Content) == 0 || doc.Content[0].Tag == "!!null" {
+			continue
+		}
+
+		// A List is expanded from its node, without serializing it.
+		node := doc.Content[0]
+		for node.Kind == goyaml.AliasNode {
+			node = node.Alias
+		}
+		if kind := mappingValue(node, "kind"); kind == nil || kind.Value != "List" {
+			obj, err := parseResource(node)
+			if err != nil {
+				return nil, fmt.Errorf("document %d: %w", i, err)
+			}
+			objs = append(objs, obj)
+			continue
+		}
+		items, err := listItems(node)
+		if err != nil {
+			return nil, fmt.Errorf("document %d: %w", i, err)
+		}
+		for j, item := range items {
+			obj, err := parseResource(item)
+			if err != nil {
+				return nil, fmt.Errorf("document %d, items[%d]: %w", i, j, err)
+			}
+			objs = append(objs, obj)
+		}
+	}
+}
+
+// parseResource parses and validates a KRM object. A List is only checked to
+// be an object with a kind.
+func parseResource(node *goyaml.Node) (*fn.KubeObject, error) {
+	for node.Kind == goyaml.AliasNode {
+		node = node.Alias
+	}
+	if node.Kind != goyaml.MappingNode {
+		return nil, fmt.Errorf("expected a Kubernetes object, got a %s", nodeKindName(node))
+	}
+	b, err := marshalYAMLNode(node)
+	if err != nil {
+		return nil, err
+	}
+	obj, err := fn.ParseKubeObject(b)
+	if err != nil {
+		return nil, err
+	}
+	if obj.GetKind() == "List" {
+		return obj, nil
+	}
+	return obj, validateResource(obj)
+}
+
+// validateResource returns an error if obj is missing its apiVersion, kind or
+// metadata.name, or if it is a Secret with data values that are not base64.
+func validateResource(obj *fn.KubeObject) error {
+	if obj.GetAPIVersion() == "" {
+		return errors.New("missing apiVersion")
+	}
+	if obj.GetKind() == "" {
+		return errors.New("missing kind")
+	}
+	if obj.GetName() == "" {
+		return fmt.Errorf("%s is missing metadata.name", obj.GetKind())
+	}
+	if obj.GetAPIVersion() != "v1" || obj.GetKind() != "Secret" {
+		return nil
+	}
+
+	data, _, err := obj.NestedStringMap("data")
+	if err != nil {
+		return fmt.Errorf("secret %q: data must be a map of keys to base64 encoded values", obj.GetName())
+	}
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if _, err := base64.StdEncoding.DecodeString(data[k]); err != nil {
+			return fmt.Errorf("secret %q: data.%s is not valid base64: %w", obj.GetName(), k, err)
+		}
+	}
+	return nil
+}
+
+// listItems returns the items of a kind: List object.
+func listItems(node *goyaml.Node) ([]*goyaml.Node, error) {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value != "items" {
+			continue
+		}
+		items := node.Content[i+1]
+		for items.Kind == goyaml.AliasNode {
+			items = items.Alias
+		}
+		if items.Tag == "!!null" {
+			return nil, nil
+		}
+		if items.Kind != goyaml.SequenceNode {
+			return nil, fmt.Errorf("items must be a list, got a %s", nodeKindName(items))
+		}
+		return items.Content, nil
+	}
+	return nil, nil
+}
+
+// nodeKindName describes the kind of a YAML node in errors.
+func nodeKindName(node *goyaml.Node) string {
+	switch node.Kind {
+	case goyaml.SequenceNode:
+		return "list"
+	case goyaml.MappingNode:
+		return "map"
+	default:
+		return "scalar"
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2026 viaduct.ai
+// SPDX-License-Identifier: Apache-2.0
+
+package ksops
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseResources(t *testing.T) {
+	data := []byte(`apiVersion: v1
+kind: Secret
+metadata:
+  name: first
+data:
+  password: aHVudGVyMg==
+---
+---
+apiVersion: v1
+kind: List
+items:
+- apiVersion: v1
+  kind: ConfigMap
+  metadata:
+    name: second
+- apiVersion: v1
+  kind: ConfigMap
+  metadata:
+    name: third
+`)
+	objs, err := parseResources(data)
+	if err != nil {
+		t.Fatalf("parseResources failed: %v", err)
+	}
+	var names []string
+	for _, obj := range objs {
+		names = append(names, obj.GetName())
+	}
+	if got := strings.Join(names, ","); got != "first,second,third" {
+		t.Errorf("expected the List to be expanded, got %s", got)
+	}
+}
+
+func TestParseResourcesErrors(t *testing.T) {
+	tests := []struct {
+		name, data, want string
+	}{
+		{
+			name: "scalar",
+			data: "just a string\n",
+			want: "document 0: expected a Kubernetes object, got a scalar",
+		},
+		{
+			name: "list",
+			data: "apiVersion: v1\nkind: Secret\nmetadata:\n  name: a\n---\n- a\n- b\n",
+			want: "document 1: expected a Kubernetes object, got a list",
+		},
+		{
+			name: "missing apiVersion",
+			data: "kind: Secret\nmetadata:\n  name: a\n",
+			want: "document 0: missing apiVersion",
+		},
+		{
+			name: "missing kind",
+			data: "apiVersion: v1\nmetadata:\n  name: a\n",
+			want: "document 0: missing kind",
+		},
+		{
+			name: "missing name",
+			data: "apiVersion: v1\nkind: Secret\nmetadata:\n  labels:\n    a: b\n",
+			want: "document 0: Secret is missing metadata.name",
+		},
+		{
+			name: "invalid base64",
+			data: "apiVersion: v1\nkind: Secret\nmetadata:\n  name: a\ndata:\n  password: hunter2\n",
+			want: `document 0: secret "a": data.password is not valid base64`,
+		},
+		{
+			name: "invalid list item",
+			data: "apiVersion: v1\nkind: List\nitems:\n- apiVersion: v1\n  kind: ConfigMap\n  metadata:\n    name: a\n- apiVersion: v1\n  kind: ConfigMap\n",
+			want: "document 0, items[1]: ConfigMap is missing metadata.name",
+		},
+		{
+			name: "invalid list items",
+			data: "apiVersion: v1\nkind: List\nitems: none\n",
+			want: "document 0: items must be a list, got a scalar",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := parseResources([]byte(tc.data))
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("expected an error containing %q, got %v", tc.want, err)
+			}
+		})
+	}
+}
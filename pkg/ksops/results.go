@@ -0,0 +1,99 @@
+// Copyright 2026 viaduct.ai
+// SPDX-License-Identifier: Apache-2.0
+
+package ksops
+
+import (
+	"errors"
+
+	"github.com/GoogleContainerTools/kpt-functions-sdk/go/fn"
+)
+
+// fieldError is an error located at a field of a ksops manifest, such as
+// secretFrom[2].envs[0], and the file that field refers to.
+type fieldError struct {
+	field    string
+	file     string
+	resource *fn.ResourceRef
+	err      error
+}
+
+// newFieldError wraps err with the field and file it was found at.
+func newFieldError(field, file string, err error) error {
+	return &fieldError{field: field, file: file, err: err}
+}
+
+// newResourceError wraps err with the resource passed through the ResourceList
+// it was found in.
+func newResourceError(obj *fn.KubeObject, err error) error {
+	return &fieldError{file: manifestPath(obj), resource: resourceRef(obj), err: err}
+}
+
+func (e *fieldError) Error() string {
+	return e.err.Error()
+}
+
+func (e *fieldError) Unwrap() error {
+	return e.err
+}
+
+// errorResults converts an error about obj into results, one per joined error.
+// Errors located with a fieldError report their field, file and resource,
+// others the file obj was read from. obj may be nil for errors that are not
+// about a single resource.
+func errorResults(err error, obj *fn.KubeObject) fn.Results {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		var results fn.Results
+		for _, e := range joined.Unwrap() {
+			results = append(results, errorResults(e, obj)...)
+		}
+		return results
+	}
+
+	result := &fn.Result{Message: err.Error(), Severity: fn.Error}
+	var field, file string
+	if obj != nil {
+		result.ResourceRef = resourceRef(obj)
+		file = manifestPath(obj)
+	}
+	var fe *fieldError
+	if errors.As(err, &fe) {
+		field = fe.field
+		if fe.file != "" {
+			file = fe.file
+		}
+		if fe.resource != nil {
+			result.ResourceRef = fe.resource
+		}
+	}
+	setLocation(result, field, file)
+	return fn.Results{result}
+}
+
+// warningResult returns a warning about a field of a ksops manifest and the
+// file it refers to. In Process, generateObjects sets the resource to the manifest.
+func warningResult(message, field, file string) *fn.Result {
+	result := &fn.Result{Message: message, Severity: fn.Warning}
+	setLocation(result, field, file)
+	return result
+}
+
+// setLocation sets the field and file of a result, when they are known.
+func setLocation(result *fn.Result, field, file string) {
+	if field != "" {
+		result.Field = &fn.Field{Path: field}
+	}
+	if file != "" {
+		result.File = &fn.File{Path: file}
+	}
+}
+
+// resourceRef returns a reference to obj.
+func resourceRef(obj *fn.KubeObject) *fn.ResourceRef {
+	return &fn.ResourceRef{
+		APIVersion: obj.GetAPIVersion(),
+		Kind:       obj.GetKind(),
+		Name:       obj.GetName(),
+		Namespace:  obj.GetNamespace(),
+	}
+}
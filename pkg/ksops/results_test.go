@@ -0,0 +1,167 @@
+// Copyright 2026 viaduct.ai
+// SPDX-License-Identifier: Apache-2.0
+
+package ksops
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/GoogleContainerTools/kpt-functions-sdk/go/fn"
+)
+
+func TestErrorResults(t *testing.T) {
+	obj, err := fn.ParseKubeObject([]byte(`apiVersion: viaduct.ai/v1
+kind: ksops
+metadata:
+  name: generator
+  annotations:
+    config.kubernetes.io/path: overlays/generate-resources.yaml
+`))
+	if err != nil {
+		t.Fatalf("failed to parse object: %v", err)
+	}
+
+	err = errors.Join(
+		newFieldError("secretFrom[2].envs[0]", "secret.enc.env", errors.New("no usable key")),
+		errors.New("unlocated"),
+	)
+	results := errorResults(err, obj)
+	if len(results) != 2 {
+		t.Fatalf("expected a result per joined error, got %d: %v", len(results), results)
+	}
+	for _, r := range results {
+		if r.Severity != fn.Error {
+			t.Errorf("severity = %q, want error", r.Severity)
+		}
+		if r.ResourceRef == nil || r.ResourceRef.Kind != "ksops" || r.ResourceRef.Name != "generator" {
+			t.Errorf("resource = %+v, want the generator", r.ResourceRef)
+		}
+	}
+
+	located, unlocated := results[0], results[1]
+	if located.Message != "no usable key" {
+		t.Errorf("message = %q", located.Message)
+	}
+	if located.Field == nil || located.Field.Path != "secretFrom[2].envs[0]" {
+		t.Errorf("field = %+v, want secretFrom[2].envs[0]", located.Field)
+	}
+	if located.File == nil || located.File.Path != "secret.enc.env" {
+		t.Errorf("file = %+v, want secret.enc.env", located.File)
+	}
+	if unlocated.Field != nil {
+		t.Errorf("field = %+v, want none", unlocated.Field)
+	}
+	if unlocated.File == nil || unlocated.File.Path != "overlays/generate-resources.yaml" {
+		t.Errorf("file = %+v, want the generator's path", unlocated.File)
+	}
+}
+
+func TestErrorResultsResourceError(t *testing.T) {
+	secret, err := fn.ParseKubeObject([]byte("apiVersion: v1\nkind: Secret\nmetadata:\n  name: mysecret\n  namespace: apps\n"))
+	if err != nil {
+		t.Fatalf("failed to parse object: %v", err)
+	}
+
+	results := errorResults(newResourceError(secret, errors.New("MAC mismatch")), nil)
+	if len(results) != 1 {
+		t.Fatalf("expected 1 result, got %d", len(results))
+	}
+	ref := results[0].ResourceRef
+	if ref == nil || ref.Kind != "Secret" || ref.Name != "mysecret" || ref.Namespace != "apps" {
+		t.Errorf("resource = %+v, want the Secret", ref)
+	}
+}
+
+// resultsByField indexes results by the field they are located at.
+func resultsByField(results fn.Results) map[string]*fn.Result {
+	byField := make(map[string]*fn.Result)
+	for _, r := range results {
+		if r.Field != nil {
+			byField[r.Field.Path] = r
+		}
+	}
+	return byField
+}
+
+func TestKRMWarnings(t *testing.T) {
+	importTestKey(t)
+
+	rl := kptResourceList(t, `  apiVersion: viaduct.ai/v1
+  kind: ksops
+  metadata:
+    name: ksops-secret-from-generator
+    annotations:
+      config.kubernetes.io/path: test/legacy/envs/generate-resources.yaml
+  secretFrom:
+  - metadata:
+      name: mysecret
+    envs:
+    - ./secret.enc.env
+    - ./empty.enc.env
+  - metadata:
+      name: registry
+    type: kubernetes.io/dockercfg
+    literals:
+    - .dockercfg={}
+`)
+
+	if ok, err := krm(rl); !ok || err != nil {
+		t.Fatalf("krm failed: %v", err)
+	}
+
+	byField := resultsByField(rl.Results)
+	empty := byField["secretFrom[0].envs[1]"]
+	if empty == nil || empty.Severity != fn.Warning {
+		t.Fatalf("expected a warning for the empty env file, got %v", rl.Results)
+	}
+	if empty.File == nil || empty.File.Path != "test/legacy/envs/empty.enc.env" {
+		t.Errorf("file = %+v, want the empty env file", empty.File)
+	}
+	if empty.ResourceRef == nil || empty.ResourceRef.Name != "ksops-secret-from-generator" {
+		t.Errorf("resource = %+v, want the generator", empty.ResourceRef)
+	}
+
+	deprecated := byField["secretFrom[1].type"]
+	if deprecated == nil || deprecated.Severity != fn.Warning {
+		t.Errorf("expected a warning for the deprecated secret type, got %v", rl.Results)
+	}
+}
+
+func TestKRMErrors(t *testing.T) {
+	importTestKey(t)
+
+	rl := kptResourceList(t, `  apiVersion: viaduct.ai/v1
+  kind: ksops
+  metadata:
+    name: ksops-secret-from-generator
+    annotations:
+      config.kubernetes.io/path: test/legacy/envs/generate-resources.yaml
+  secretFrom:
+  - metadata:
+      name: mysecret
+    envs:
+    - ./secret.enc.env
+  - metadata:
+      name: broken
+    envs:
+    - ./secret.enc.env
+    - ./missing.enc.env
+`)
+
+	ok, err := krm(rl)
+	if ok || err == nil {
+		t.Fatal("expected krm to fail for a missing env file")
+	}
+
+	failure := resultsByField(rl.Results)["secretFrom[1].envs[1]"]
+	if failure == nil || failure.Severity != fn.Error {
+		t.Fatalf("expected an error at secretFrom[1].envs[1], got %v", rl.Results)
+	}
+	if failure.File == nil || failure.File.Path != "./missing.enc.env" {
+		t.Errorf("file = %+v, want the missing env file", failure.File)
+	}
+	if failure.ResourceRef == nil || failure.ResourceRef.Name != "ksops-secret-from-generator" {
+		t.Errorf("resource = %+v, want the generator", failure.ResourceRef)
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright 2026 viaduct.ai
+// SPDX-License-Identifier: Apache-2.0
+
+package ksops
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"regexp"
+	"time"
+)
+
+const (
+	defaultRetryAttempts  = 3
+	defaultRetryBaseDelay = 200 * time.Millisecond
+	maxRetryDelay         = 10 * time.Second
+)
+
+// retryPolicy retries transient key provider errors with jittered exponential backoff.
+type retryPolicy struct {
+	// attempts is the maximum number of attempts, 1 disables retries.
+	attempts  int
+	baseDelay time.Duration
+	// log reports retries, if not nil.
+	log *slog.Logger
+}
+
+// validate returns an error if the policy does not make at least one attempt
+// or has a negative delay.
+func (p retryPolicy) validate() error {
+	if p.attempts < 1 {
+		return fmt.Errorf("invalid retry attempts %d: must be a positive integer", p.attempts)
+	}
+	if p.baseDelay < 0 {
+		return fmt.Errorf("invalid retry base delay %s: must not be negative", p.baseDelay)
+	}
+	return nil
+}
+
+// do calls f until it succeeds, fails with an error that is not transient, the
+// attempts are exhausted or ctx is done.
+func (p retryPolicy) do(ctx context.Context, f func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := f()
+		if err == nil || !isTransient(err) {
+			return err
+		}
+		if attempt >= p.attempts {
+			if p.attempts > 1 {
+				return fmt.Errorf("giving up after %d attempts: %w", attempt, err)
+			}
+			return err
+		}
+
+		delay := p.delay(attempt)
+		if p.log != nil {
+			p.log.Warn("retrying after a transient error", "attempt", attempt, "delay", delay, "error", err)
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// delay returns the backoff before the next attempt: half of the exponential
+// delay, capped at maxRetryDelay, plus a random jitter of up to the other half.
+// A zero base delay retries immediately.
+func (p retryPolicy) delay(attempt int) time.Duration {
+	if p.baseDelay == 0 {
+		return 0
+	}
+	shift := attempt - 1
+	d := p.baseDelay << shift
+	// The shift overflows when shifting back does not restore the base delay.
+	if d>>shift != p.baseDelay || d > maxRetryDelay {
+		d = maxRetryDelay
+	}
+	half := d / 2
+	return half + rand.N(d-half+1)
+}
+
+// transientPattern matches the errors of key providers that are worth retrying:
+// throttling, 5xx responses and network failures. SOPS flattens the errors of
+// its key providers into messages, so they are matched on text.
+var transientPattern = regexp.MustCompile(`(?i)throttl|rate exceeded|too ?many ?requests|` +
+	`status ?code[:=]? ?(429|5\d\d)|response (429|5\d\d)|code = (unavailable|resourceexhausted)|` +
+	`connection reset|connection refused|broken pipe|i/o timeout|tls handshake timeout|unexpected eof`)
+
+// isTransient reports whether a decryption error is transient. Errors caused by
+// a cancelled or timed out context are not.
+func isTransient(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	msg := err.Error()
+	var userErr interface{ UserError() string }
+	if errors.As(err, &userErr) {
+		msg += "\n" + userErr.UserError()
+	}
+	return transientPattern.MatchString(msg)
+}
@@ -0,0 +1,167 @@
+// Copyright 2026 viaduct.ai
+// SPDX-License-Identifier: Apache-2.0
+
+package ksops
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeKMS is a local AWS KMS endpoint. It fails the first failures Decrypt
+// calls with status and errorType, then decrypts. The fixture test/kms/secret.enc.yaml
+// was encrypted against an identity KMS, so its ciphertext is the data key.
+type fakeKMS struct {
+	failures  int32
+	status    int
+	errorType string
+	calls     atomic.Int32
+}
+
+func (k *fakeKMS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		CiphertextBlob string
+		KeyId          string
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+	if k.calls.Add(1) <= k.failures {
+		w.WriteHeader(k.status)
+		fmt.Fprintf(w, `{"__type":%q,"message":"fake KMS failure"}`, k.errorType)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(map[string]string{"KeyId": req.KeyId, "Plaintext": req.CiphertextBlob})
+}
+
+// useFakeKMS points the AWS SDK at kms, without SDK retries or credentials from the host.
+func useFakeKMS(t *testing.T, kms *fakeKMS) {
+	t.Helper()
+	server := httptest.NewServer(kms)
+	t.Cleanup(server.Close)
+
+	empty := filepath.Join(t.TempDir(), "empty")
+	t.Setenv("AWS_ENDPOINT_URL", server.URL)
+	t.Setenv("AWS_MAX_ATTEMPTS", "1")
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	t.Setenv("AWS_SESSION_TOKEN", "")
+	t.Setenv("AWS_PROFILE", "")
+	t.Setenv("AWS_CONFIG_FILE", empty)
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", empty)
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+}
+
+func TestGenerateRetriesTransientErrors(t *testing.T) {
+	file := testFixturePath(t, "test", "kms", "secret.enc.yaml")
+	manifest := makeManifest([]string{file})
+
+	tests := []struct {
+		name      string
+		kms       *fakeKMS
+		attempts  int
+		wantCalls int32
+		wantErr   string
+	}{
+		{
+			name:      "throttling is retried",
+			kms:       &fakeKMS{failures: 2, status: http.StatusBadRequest, errorType: "ThrottlingException"},
+			wantCalls: 3,
+		},
+		{
+			name:      "server errors are retried until the attempts are exhausted",
+			kms:       &fakeKMS{failures: 10, status: http.StatusInternalServerError, errorType: "KMSInternalException"},
+			attempts:  4,
+			wantCalls: 4,
+			wantErr:   "giving up after 4 attempts",
+		},
+		{
+			name:      "permanent errors are not retried",
+			kms:       &fakeKMS{failures: 10, status: http.StatusBadRequest, errorType: "InvalidCiphertextException"},
+			wantCalls: 1,
+			wantErr:   "trouble decrypting file",
+		},
+		{
+			name:      "retries can be disabled",
+			kms:       &fakeKMS{failures: 1, status: http.StatusBadRequest, errorType: "ThrottlingException"},
+			attempts:  1,
+			wantCalls: 1,
+			wantErr:   "trouble decrypting file",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			useFakeKMS(t, tc.kms)
+
+			out, _, err := generate(context.Background(), manifest, "", WithRetry(cmp.Or(tc.attempts, defaultRetryAttempts), time.Millisecond))
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Errorf("expected error containing %q, got %v", tc.wantErr, err)
+				}
+			} else if err != nil {
+				t.Fatalf("generate failed: %v", err)
+			} else if !strings.Contains(out, "fr0m-kms") {
+				t.Errorf("expected the decrypted secret, got:\n%s", out)
+			}
+			if got := tc.kms.calls.Load(); got != tc.wantCalls {
+				t.Errorf("KMS was called %d times, want %d", got, tc.wantCalls)
+			}
+		})
+	}
+}
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{err: errors.New("operation error KMS: Decrypt, https response error StatusCode: 400, RequestID: 1, api error ThrottlingException: Rate exceeded"), want: true},
+		{err: errors.New("https response error StatusCode: 503, RequestID: 1, api error ServiceUnavailable"), want: true},
+		{err: errors.New("rpc error: code = Unavailable desc = connection error"), want: true},
+		{err: errors.New("read tcp 10.0.0.1:443: read: connection reset by peer"), want: true},
+		{err: errors.New("Failed to verify data integrity. expected mac \"a\", got \"b\""), want: false},
+		{err: errors.New("Error getting data key: 0 successful groups required, got 0"), want: false},
+		{err: newFieldError("files[0]", "", keyError{}), want: false},
+		{err: fmt.Errorf("throttled, but: %w", timeoutError("file timeout", time.Second)), want: false},
+	}
+	for _, tc := range tests {
+		if got := isTransient(tc.err); got != tc.want {
+			t.Errorf("isTransient(%q) = %v, want %v", tc.err, got, tc.want)
+		}
+	}
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	tests := []struct {
+		base    time.Duration
+		attempt int
+		want    time.Duration
+	}{
+		{base: 100 * time.Millisecond, attempt: 1, want: 100 * time.Millisecond},
+		{base: 100 * time.Millisecond, attempt: 3, want: 400 * time.Millisecond},
+		{base: 100 * time.Millisecond, attempt: 20, want: maxRetryDelay},
+		{base: 100 * time.Millisecond, attempt: 70, want: maxRetryDelay},
+		{base: 0, attempt: 1, want: 0},
+		{base: 0, attempt: 20, want: 0},
+	}
+	for _, tc := range tests {
+		p := retryPolicy{attempts: 10, baseDelay: tc.base}
+		for range 10 {
+			if d := p.delay(tc.attempt); d < tc.want/2 || d > tc.want {
+				t.Errorf("delay(%d) with base %s = %s, want between %s and %s", tc.attempt, tc.base, d, tc.want/2, tc.want)
+			}
+		}
+	}
+}
@@ -0,0 +1,182 @@
+// Copyright 2026 viaduct.ai
+// SPDX-License-Identifier: Apache-2.0
+
+package ksops
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Well-known Secret types, see https://kubernetes.io/docs/concepts/configuration/secret/#secret-types
+const (
+	secretTypeDockerConfigJSON    = "kubernetes.io/dockerconfigjson"
+	secretTypeDockerCfg           = "kubernetes.io/dockercfg"
+	secretTypeTLS                 = "kubernetes.io/tls"
+	secretTypeBasicAuth           = "kubernetes.io/basic-auth"
+	secretTypeSSHAuth             = "kubernetes.io/ssh-auth"
+	secretTypeServiceAccountToken = "kubernetes.io/service-account-token"
+
+	serviceAccountNameAnnotation = "kubernetes.io/service-account.name"
+)
+
+// deprecatedSecretTypes maps Secret types that are still supported, but
+// deprecated, to their replacement.
+var deprecatedSecretTypes = map[string]string{
+	secretTypeDockerCfg: secretTypeDockerConfigJSON,
+}
+
+type dockerConfigJSON struct {
+	Auths map[string]dockerConfigEntry `json:"auths"`
+}
+
+type dockerConfigEntry struct {
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	Email    string `json:"email,omitempty"`
+	Auth     string `json:"auth,omitempty"`
+}
+
+// buildTypedSecret renders the keys of well-known Secret types from simpler
+// inputs and validates that the keys required by the type are present.
+func buildTypedSecret(s *kubernetesSecret) error {
+	var err error
+	switch s.Type {
+	case secretTypeDockerConfigJSON:
+		err = buildDockerConfigJSON(s)
+	case secretTypeDockerCfg:
+		err = requireSecretKeys(s, ".dockercfg")
+	case secretTypeTLS:
+		err = renameSecretKeys(s, map[string]string{"cert": "tls.crt", "key": "tls.key", "ca": "ca.crt"})
+		if err == nil {
+			err = requireSecretKeys(s, "tls.crt", "tls.key")
+		}
+	case secretTypeBasicAuth:
+		if !hasSecretKey(s, "username") && !hasSecretKey(s, "password") {
+			err = fmt.Errorf("missing required key: one of \"username\" or \"password\"")
+		}
+	case secretTypeSSHAuth:
+		err = requireSecretKeys(s, "ssh-privatekey")
+	case secretTypeServiceAccountToken:
+		if s.Metadata.Annotations[serviceAccountNameAnnotation] == "" {
+			err = fmt.Errorf("missing required annotation %q", serviceAccountNameAnnotation)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("invalid %s secret %q: %w", s.Type, s.Metadata.Name, err)
+	}
+	return nil
+}
+
+// buildDockerConfigJSON renders the registry, username, password and optional
+// email keys into a .dockerconfigjson key. A .dockerconfigjson key provided
+// directly is validated instead.
+func buildDockerConfigJSON(s *kubernetesSecret) error {
+	inputs := []string{"registry", "username", "password", "email"}
+	var given []string
+	for _, k := range inputs {
+		if hasSecretKey(s, k) {
+			given = append(given, k)
+		}
+	}
+
+	if hasSecretKey(s, ".dockerconfigjson") {
+		if len(given) > 0 {
+			return fmt.Errorf(".dockerconfigjson cannot be combined with the %s keys", strings.Join(given, ", "))
+		}
+		raw, _ := secretValue(s, ".dockerconfigjson")
+		var config dockerConfigJSON
+		if err := json.Unmarshal([]byte(raw), &config); err != nil {
+			return fmt.Errorf("error parsing .dockerconfigjson: %w", err)
+		}
+		if len(config.Auths) == 0 {
+			return fmt.Errorf(".dockerconfigjson does not contain any auths")
+		}
+		return nil
+	}
+
+	if err := requireSecretKeys(s, "registry", "username", "password"); err != nil {
+		return err
+	}
+
+	values := make(map[string]string)
+	for _, k := range given {
+		values[k], _ = secretValue(s, k)
+		delete(s.StringData, k)
+		delete(s.Data, k)
+	}
+
+	config := dockerConfigJSON{Auths: map[string]dockerConfigEntry{
+		values["registry"]: {
+			Username: values["username"],
+			Password: values["password"],
+			Email:    values["email"],
+			Auth:     base64.StdEncoding.EncodeToString([]byte(values["username"] + ":" + values["password"])),
+		},
+	}}
+	b, err := json.Marshal(config)
+	if err != nil {
+		return fmt.Errorf("error marshalling .dockerconfigjson: %w", err)
+	}
+	if s.StringData == nil {
+		s.StringData = make(map[string]string)
+	}
+	s.StringData[".dockerconfigjson"] = string(b)
+	return nil
+}
+
+// renameSecretKeys moves the keys of a Secret to their names for the type,
+// keeping them in stringData or data.
+func renameSecretKeys(s *kubernetesSecret, names map[string]string) error {
+	for from, to := range names {
+		if !hasSecretKey(s, from) {
+			continue
+		}
+		if hasSecretKey(s, to) {
+			return fmt.Errorf("keys %q and %q cannot both be set", from, to)
+		}
+		if v, ok := s.StringData[from]; ok {
+			delete(s.StringData, from)
+			s.StringData[to] = v
+		}
+		if v, ok := s.Data[from]; ok {
+			delete(s.Data, from)
+			s.Data[to] = v
+		}
+	}
+	return nil
+}
+
+// requireSecretKeys returns an error naming the first of keys missing from the Secret.
+func requireSecretKeys(s *kubernetesSecret, keys ...string) error {
+	for _, k := range keys {
+		if !hasSecretKey(s, k) {
+			return fmt.Errorf("missing required key %q", k)
+		}
+	}
+	return nil
+}
+
+// hasSecretKey reports whether key is set in the Secret's stringData or data.
+func hasSecretKey(s *kubernetesSecret, key string) bool {
+	_, ok := secretValue(s, key)
+	return ok
+}
+
+// secretValue returns the value of key from the Secret's stringData, or the
+// decoded value from its data.
+func secretValue(s *kubernetesSecret, key string) (string, bool) {
+	if v, ok := s.StringData[key]; ok {
+		return v, true
+	}
+	if v, ok := s.Data[key]; ok {
+		b, err := base64.StdEncoding.DecodeString(v)
+		if err != nil {
+			return "", false
+		}
+		return string(b), true
+	}
+	return "", false
+}
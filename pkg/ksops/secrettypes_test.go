@@ -0,0 +1,190 @@
+// Copyright 2026 viaduct.ai
+// SPDX-License-Identifier: Apache-2.0
+
+package ksops
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"sigs.k8s.io/kustomize/api/types"
+)
+
+func TestBuildTypedSecret(t *testing.T) {
+	tests := []struct {
+		name           string
+		secret         kubernetesSecret
+		wantStringData map[string]string
+		wantData       map[string]string
+		wantErr        string
+	}{
+		{
+			name: "untyped secret is unchanged",
+			secret: kubernetesSecret{
+				StringData: map[string]string{"registry": "ghcr.io"},
+			},
+			wantStringData: map[string]string{"registry": "ghcr.io"},
+		},
+		{
+			name: "dockerconfigjson from credentials",
+			secret: kubernetesSecret{
+				Type:       secretTypeDockerConfigJSON,
+				StringData: map[string]string{"registry": "ghcr.io", "username": "robot", "password": "s3cr3t"},
+			},
+			wantStringData: map[string]string{
+				".dockerconfigjson": `{"auths":{"ghcr.io":{"username":"robot","password":"s3cr3t","auth":"cm9ib3Q6czNjcjN0"}}}`,
+			},
+		},
+		{
+			name: "dockerconfigjson with binary password",
+			secret: kubernetesSecret{
+				Type:       secretTypeDockerConfigJSON,
+				StringData: map[string]string{"registry": "ghcr.io", "username": "robot", "email": "robot@example.com"},
+				Data:       map[string]string{"password": "czNjcjN0"},
+			},
+			wantStringData: map[string]string{
+				".dockerconfigjson": `{"auths":{"ghcr.io":{"username":"robot","password":"s3cr3t","email":"robot@example.com","auth":"cm9ib3Q6czNjcjN0"}}}`,
+			},
+			wantData: map[string]string{},
+		},
+		{
+			name: "dockerconfigjson given directly",
+			secret: kubernetesSecret{
+				Type:       secretTypeDockerConfigJSON,
+				StringData: map[string]string{".dockerconfigjson": `{"auths":{"ghcr.io":{"auth":"eDp5"}}}`},
+			},
+			wantStringData: map[string]string{".dockerconfigjson": `{"auths":{"ghcr.io":{"auth":"eDp5"}}}`},
+		},
+		{
+			name: "dockerconfigjson missing password",
+			secret: kubernetesSecret{
+				Type:       secretTypeDockerConfigJSON,
+				StringData: map[string]string{"registry": "ghcr.io", "username": "robot"},
+			},
+			wantErr: `missing required key "password"`,
+		},
+		{
+			name: "dockerconfigjson given with credentials",
+			secret: kubernetesSecret{
+				Type:       secretTypeDockerConfigJSON,
+				StringData: map[string]string{".dockerconfigjson": `{"auths":{}}`, "username": "robot"},
+			},
+			wantErr: "cannot be combined with the username keys",
+		},
+		{
+			name: "dockerconfigjson invalid json",
+			secret: kubernetesSecret{
+				Type:       secretTypeDockerConfigJSON,
+				StringData: map[string]string{".dockerconfigjson": "not json"},
+			},
+			wantErr: "error parsing .dockerconfigjson",
+		},
+		{
+			name: "tls keys renamed",
+			secret: kubernetesSecret{
+				Type:       secretTypeTLS,
+				StringData: map[string]string{"cert": "CERT", "key": "KEY"},
+				Data:       map[string]string{"ca": "Q0E="},
+			},
+			wantStringData: map[string]string{"tls.crt": "CERT", "tls.key": "KEY"},
+			wantData:       map[string]string{"ca.crt": "Q0E="},
+		},
+		{
+			name: "tls missing key",
+			secret: kubernetesSecret{
+				Type:       secretTypeTLS,
+				StringData: map[string]string{"tls.crt": "CERT"},
+			},
+			wantErr: `missing required key "tls.key"`,
+		},
+		{
+			name: "tls alias and key both set",
+			secret: kubernetesSecret{
+				Type:       secretTypeTLS,
+				StringData: map[string]string{"cert": "CERT", "tls.crt": "CERT", "tls.key": "KEY"},
+			},
+			wantErr: `keys "cert" and "tls.crt" cannot both be set`,
+		},
+		{
+			name: "basic-auth with password only",
+			secret: kubernetesSecret{
+				Type:       secretTypeBasicAuth,
+				StringData: map[string]string{"password": "s3cr3t"},
+			},
+			wantStringData: map[string]string{"password": "s3cr3t"},
+		},
+		{
+			name:    "basic-auth missing credentials",
+			secret:  kubernetesSecret{Type: secretTypeBasicAuth},
+			wantErr: `one of "username" or "password"`,
+		},
+		{
+			name:    "ssh-auth missing private key",
+			secret:  kubernetesSecret{Type: secretTypeSSHAuth, StringData: map[string]string{"key": "x"}},
+			wantErr: `missing required key "ssh-privatekey"`,
+		},
+		{
+			name:    "dockercfg missing key",
+			secret:  kubernetesSecret{Type: secretTypeDockerCfg},
+			wantErr: `missing required key ".dockercfg"`,
+		},
+		{
+			name:    "service-account-token missing annotation",
+			secret:  kubernetesSecret{Type: secretTypeServiceAccountToken},
+			wantErr: serviceAccountNameAnnotation,
+		},
+		{
+			name: "service-account-token with annotation",
+			secret: kubernetesSecret{
+				Type:     secretTypeServiceAccountToken,
+				Metadata: types.ObjectMeta{Annotations: map[string]string{serviceAccountNameAnnotation: "builder"}},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s := tc.secret
+			err := buildTypedSecret(&s)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(s.StringData, tc.wantStringData) {
+				t.Errorf("stringData = %v, want %v", s.StringData, tc.wantStringData)
+			}
+			if !reflect.DeepEqual(s.Data, tc.wantData) {
+				t.Errorf("data = %v, want %v", s.Data, tc.wantData)
+			}
+		})
+	}
+}
+
+func TestGenerateTypedSecretMissingKey(t *testing.T) {
+	importTestKey(t)
+
+	file := testFixturePath(t, "test", "legacy", "envs", "secret.enc.env")
+	manifest := makeManifest(nil, `secretFrom:
+- metadata:
+    name: mysecret
+  type: kubernetes.io/ssh-auth
+  envs:
+  - `+file)
+
+	_, _, err := generate(context.Background(), manifest, "")
+	if err == nil {
+		t.Fatal("expected error for a missing ssh-privatekey")
+	}
+	for _, want := range []string{"kubernetes.io/ssh-auth", `"mysecret"`, `"ssh-privatekey"`} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error should mention %q: %v", want, err)
+		}
+	}
+}
@@ -0,0 +1,278 @@
+// Copyright 2026 viaduct.ai
+// SPDX-License-Identifier: Apache-2.0
+
+package ksops
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/getsops/sops/v3/cmd/sops/formats"
+	"github.com/joho/godotenv"
+	goyaml "go.yaml.in/yaml/v3"
+	"gopkg.in/ini.v1"
+)
+
+// selectorElement is a single step of a selector: a map key or a list index.
+type selectorElement struct {
+	key     string
+	index   int
+	isIndex bool
+}
+
+func (e selectorElement) String() string {
+	if e.isIndex {
+		return fmt.Sprintf("[%d]", e.index)
+	}
+	if strings.ContainsAny(e.key, `.[]"`) {
+		return fmt.Sprintf(".%q", e.key)
+	}
+	return "." + e.key
+}
+
+// splitSelector splits a path#selector file reference into the path and the
+// selector. As file names may contain '#', a reference is not split when exists
+// reports that it is a file. Otherwise it is split at the first '#' followed by
+// a selector, starting with '.', '[' or '$', or else at the first '#'.
+func splitSelector(ref string, exists func(path string) bool) (string, string) {
+	if !strings.Contains(ref, "#") || exists(ref) {
+		return ref, ""
+	}
+	for i := range len(ref) - 1 {
+		if ref[i] == '#' && strings.ContainsRune(".[$", rune(ref[i+1])) {
+			return ref[:i], ref[i+1:]
+		}
+	}
+	path, selector, _ := strings.Cut(ref, "#")
+	return path, selector
+}
+
+// fileKeyPathSelector is fileKeyPath for file references that may select a
+// value with a path#selector suffix, split by splitSelector. When no key is
+// given, the key defaults to the last map key of the selector, or to the file
+// name.
+func fileKeyPathSelector(file string, exists func(path string) bool) (string, string, string, error) {
+	key, path, err := fileKeyPath(file)
+	if err != nil {
+		return "", "", "", err
+	}
+	path, selector := splitSelector(path, exists)
+	if selector == "" {
+		return key, path, "", nil
+	}
+
+	elements, err := parseSelector(selector)
+	if err != nil {
+		return "", "", "", err
+	}
+	if !strings.Contains(file, "=") {
+		key = filepath.Base(path)
+		for i := len(elements) - 1; i >= 0; i-- {
+			if !elements[i].isIndex {
+				key = elements[i].key
+				break
+			}
+		}
+	}
+	return key, path, selector, nil
+}
+
+// parseSelector parses a yq style selector, such as .database.password,
+// .servers[0].host or ."key.with.dots", into its elements. A leading JSONPath
+// style $ is ignored, and "." selects the whole document.
+func parseSelector(selector string) ([]selectorElement, error) {
+	s := strings.TrimPrefix(selector, "$")
+	if s == "." {
+		return nil, nil
+	}
+	if s == "" || (s[0] != '.' && s[0] != '[') {
+		return nil, fmt.Errorf("invalid selector %q: must start with '.' or '['", selector)
+	}
+
+	var elements []selectorElement
+	for len(s) > 0 {
+		switch s[0] {
+		case '.':
+			s = s[1:]
+			if strings.HasPrefix(s, `"`) {
+				end := strings.Index(s[1:], `"`)
+				if end < 0 {
+					return nil, fmt.Errorf("invalid selector %q: unterminated quoted key", selector)
+				}
+				elements = append(elements, selectorElement{key: s[1 : end+1]})
+				s = s[end+2:]
+				continue
+			}
+			end := strings.IndexAny(s, ".[")
+			if end < 0 {
+				end = len(s)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("invalid selector %q: empty key", selector)
+			}
+			elements = append(elements, selectorElement{key: s[:end]})
+			s = s[end:]
+		case '[':
+			end := strings.Index(s, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("invalid selector %q: unterminated '['", selector)
+			}
+			inner := s[1:end]
+			s = s[end+1:]
+			if len(inner) >= 2 && (inner[0] == '"' || inner[0] == '\'') && inner[len(inner)-1] == inner[0] {
+				elements = append(elements, selectorElement{key: inner[1 : len(inner)-1]})
+				continue
+			}
+			index, err := strconv.Atoi(inner)
+			if err != nil || index < 0 {
+				return nil, fmt.Errorf("invalid selector %q: %q is not a list index", selector, inner)
+			}
+			elements = append(elements, selectorElement{index: index, isIndex: true})
+		default:
+			return nil, fmt.Errorf("invalid selector %q: unexpected %q", selector, s[0])
+		}
+	}
+	return elements, nil
+}
+
+// selectValue extracts the value at selector from decrypted data. Scalars are
+// returned as is. Maps and lists are serialized as JSON for JSON files and as
+// YAML otherwise.
+func selectValue(data []byte, format formats.Format, selector string) (string, error) {
+	elements, err := parseSelector(selector)
+	if err != nil {
+		return "", err
+	}
+
+	node, err := parseDocument(data, format)
+	if err != nil {
+		return "", err
+	}
+
+	var walked strings.Builder
+	for _, e := range elements {
+		for node.Kind == goyaml.AliasNode {
+			node = node.Alias
+		}
+		var next *goyaml.Node
+		switch {
+		case e.isIndex && node.Kind == goyaml.SequenceNode:
+			if e.index < len(node.Content) {
+				next = node.Content[e.index]
+			}
+		case !e.isIndex && node.Kind == goyaml.MappingNode:
+			next = mappingValue(node, e.key)
+		}
+		if next == nil {
+			at := walked.String()
+			if at == "" {
+				at = "."
+			}
+			return "", fmt.Errorf("selector %q: %s not found at %s", selector, e, at)
+		}
+		walked.WriteString(e.String())
+		node = next
+	}
+	for node.Kind == goyaml.AliasNode {
+		node = node.Alias
+	}
+
+	if node.Kind == goyaml.ScalarNode {
+		return node.Value, nil
+	}
+	if format == formats.Json {
+		var v interface{}
+		if err := node.Decode(&v); err != nil {
+			return "", fmt.Errorf("selector %q: %w", selector, err)
+		}
+		b, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return "", fmt.Errorf("selector %q: %w", selector, err)
+		}
+		return string(b) + "\n", nil
+	}
+	b, err := marshalYAMLNode(node)
+	if err != nil {
+		return "", fmt.Errorf("selector %q: %w", selector, err)
+	}
+	return string(b), nil
+}
+
+// parseDocument parses decrypted data into a YAML node tree. Dotenv files
+// become a flat map and INI files a map of sections, with the keys of the
+// default section at the top level.
+func parseDocument(data []byte, format formats.Format) (*goyaml.Node, error) {
+	switch format {
+	case formats.Yaml, formats.Json:
+		var doc goyaml.Node
+		if err := goyaml.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("error parsing decrypted data: %w", err)
+		}
+		if len(doc.Content) == 0 {
+			return &goyaml.Node{Kind: goyaml.MappingNode}, nil
+		}
+		return doc.Content[0], nil
+	case formats.Dotenv:
+		env, err := godotenv.Unmarshal(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("error parsing decrypted data: %w", err)
+		}
+		keys := make([]string, 0, len(env))
+		for k := range env {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		m := &goyaml.Node{Kind: goyaml.MappingNode}
+		for _, k := range keys {
+			appendMapping(m, k, env[k])
+		}
+		return m, nil
+	case formats.Ini:
+		f, err := ini.Load(data)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing decrypted data: %w", err)
+		}
+		m := &goyaml.Node{Kind: goyaml.MappingNode}
+		for _, section := range f.Sections() {
+			target := m
+			if section.Name() != ini.DefaultSection {
+				target = &goyaml.Node{Kind: goyaml.MappingNode}
+				m.Content = append(m.Content, &goyaml.Node{Kind: goyaml.ScalarNode, Value: section.Name()}, target)
+			}
+			for _, key := range section.Keys() {
+				appendMapping(target, key.Name(), key.Value())
+			}
+		}
+		return m, nil
+	default:
+		return nil, fmt.Errorf("values cannot be selected from binary files")
+	}
+}
+
+// appendMapping adds a string key and value to a YAML mapping node.
+func appendMapping(m *goyaml.Node, key, value string) {
+	m.Content = append(m.Content,
+		&goyaml.Node{Kind: goyaml.ScalarNode, Value: key},
+		&goyaml.Node{Kind: goyaml.ScalarNode, Value: value},
+	)
+}
+
+// marshalYAMLNode serializes a YAML node with the two space indentation used
+// by kustomize and kubectl.
+func marshalYAMLNode(node *goyaml.Node) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := goyaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(node); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
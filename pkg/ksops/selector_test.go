@@ -0,0 +1,213 @@
+// Copyright 2026 viaduct.ai
+// SPDX-License-Identifier: Apache-2.0
+
+package ksops
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/getsops/sops/v3/cmd/sops/formats"
+)
+
+func TestParseSelector(t *testing.T) {
+	tests := []struct {
+		selector string
+		want     []selectorElement
+		wantErr  bool
+	}{
+		{selector: ".", want: nil},
+		{selector: ".a", want: []selectorElement{{key: "a"}}},
+		{selector: "$.a.b", want: []selectorElement{{key: "a"}, {key: "b"}}},
+		{selector: ".a[2].b", want: []selectorElement{{key: "a"}, {index: 2, isIndex: true}, {key: "b"}}},
+		{selector: `."a.b".c`, want: []selectorElement{{key: "a.b"}, {key: "c"}}},
+		{selector: `.a["b.c"]`, want: []selectorElement{{key: "a"}, {key: "b.c"}}},
+		{selector: "[0]", want: []selectorElement{{index: 0, isIndex: true}}},
+		{selector: "a.b", wantErr: true},
+		{selector: ".a..b", wantErr: true},
+		{selector: ".a[", wantErr: true},
+		{selector: ".a[-1]", wantErr: true},
+		{selector: `."a`, wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.selector, func(t *testing.T) {
+			got, err := parseSelector(tc.selector)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("expected error for %q, got %v", tc.selector, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("parseSelector(%q) = %+v, want %+v", tc.selector, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestFileKeyPathSelector(t *testing.T) {
+	tests := []struct {
+		file                string
+		key, path, selector string
+	}{
+		{file: "secret.enc.yaml", key: "secret.enc.yaml", path: "secret.enc.yaml"},
+		{file: "k=secret.enc.yaml#.a.b", key: "k", path: "secret.enc.yaml", selector: ".a.b"},
+		{file: "dir/secret.enc.yaml#.a.b", key: "b", path: "dir/secret.enc.yaml", selector: ".a.b"},
+		{file: "secret.enc.yaml#.a[0]", key: "a", path: "secret.enc.yaml", selector: ".a[0]"},
+		{file: "secret.enc.yaml#[0]", key: "secret.enc.yaml", path: "secret.enc.yaml", selector: "[0]"},
+		{file: "secret.enc.yaml#$.a", key: "a", path: "secret.enc.yaml", selector: "$.a"},
+		// File names may contain '#'.
+		{file: "team#1.enc.yaml", key: "team#1.enc.yaml", path: "team#1.enc.yaml"},
+		{file: "k=team#1.enc.yaml", key: "k", path: "team#1.enc.yaml"},
+		{file: "team#1.enc.yaml#.a", key: "a", path: "team#1.enc.yaml", selector: ".a"},
+	}
+
+	exists := func(path string) bool { return path == "team#1.enc.yaml" }
+	for _, tc := range tests {
+		t.Run(tc.file, func(t *testing.T) {
+			key, path, selector, err := fileKeyPathSelector(tc.file, exists)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if key != tc.key || path != tc.path || selector != tc.selector {
+				t.Errorf("fileKeyPathSelector(%q) = (%q, %q, %q), want (%q, %q, %q)",
+					tc.file, key, path, selector, tc.key, tc.path, tc.selector)
+			}
+		})
+	}
+}
+
+func TestFileKeyPathSelectorInvalid(t *testing.T) {
+	missing := func(string) bool { return false }
+	if _, _, _, err := fileKeyPathSelector("a=b=c", missing); err == nil || !strings.Contains(err.Error(), "invalid format") {
+		t.Errorf("expected an invalid format error, got %v", err)
+	}
+	// A missing file is split at its first '#'.
+	if _, _, _, err := fileKeyPathSelector("missing#1.enc.yaml", missing); err == nil || !strings.Contains(err.Error(), "invalid selector") {
+		t.Errorf("expected an invalid selector error, got %v", err)
+	}
+}
+
+func TestSelectValue(t *testing.T) {
+	yamlData := []byte(`database:
+  password: hunter2
+  port: 5432
+  hosts:
+  - a.internal
+  - b.internal
+`)
+	jsonData := []byte(`{"partner": {"id": "12345", "tags": ["x"]}}`)
+	envData := []byte("USER=admin\nPASSWORD=hunter2\n")
+	iniData := []byte("global = yes\n\n[smtp]\nuser = mailer\npassword = hunter2\n")
+
+	tests := []struct {
+		name     string
+		data     []byte
+		format   formats.Format
+		selector string
+		want     string
+		wantErr  string
+	}{
+		{name: "yaml scalar", data: yamlData, format: formats.Yaml, selector: ".database.password", want: "hunter2"},
+		{name: "yaml number", data: yamlData, format: formats.Yaml, selector: ".database.port", want: "5432"},
+		{name: "yaml list index", data: yamlData, format: formats.Yaml, selector: ".database.hosts[1]", want: "b.internal"},
+		{name: "yaml sub-document", data: yamlData, format: formats.Yaml, selector: ".database.hosts", want: "- a.internal\n- b.internal\n"},
+		{name: "json scalar", data: jsonData, format: formats.Json, selector: ".partner.id", want: "12345"},
+		{name: "json sub-document", data: jsonData, format: formats.Json, selector: ".partner", want: "{\n  \"id\": \"12345\",\n  \"tags\": [\n    \"x\"\n  ]\n}\n"},
+		{name: "dotenv key", data: envData, format: formats.Dotenv, selector: ".PASSWORD", want: "hunter2"},
+		{name: "ini section key", data: iniData, format: formats.Ini, selector: ".smtp.password", want: "hunter2"},
+		{name: "ini default section key", data: iniData, format: formats.Ini, selector: ".global", want: "yes"},
+		{name: "missing key", data: yamlData, format: formats.Yaml, selector: ".database.user", wantErr: ".user not found at .database"},
+		{name: "index out of range", data: yamlData, format: formats.Yaml, selector: ".database.hosts[5]", wantErr: "[5] not found"},
+		{name: "key on a list", data: yamlData, format: formats.Yaml, selector: ".database.hosts.a", wantErr: ".a not found"},
+		{name: "binary", data: []byte("raw"), format: formats.Binary, selector: ".a", wantErr: "binary"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := selectValue(tc.data, tc.format, tc.selector)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("selectValue(%q) = %q, want %q", tc.selector, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestGenerateSecretFromSelector(t *testing.T) {
+	importTestKey(t)
+
+	dir := testFixturePath(t, "test", "krm", "selector")
+	manifest := makeManifest(nil, `secretFrom:
+- metadata:
+    name: mysecret
+  files:
+  - db-password=`+dir+`/secrets.enc.yaml#.database.password
+  - `+dir+`/app.enc.ini#.smtp.user`)
+
+	got, _, err := generate(context.Background(), manifest, "")
+	if err != nil {
+		t.Fatalf("generate failed: %v", err)
+	}
+	for _, want := range []string{"db-password: 1f2d1e2e67df", "user: mailer"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output missing %q:\n%s", want, got)
+		}
+	}
+
+	manifest = makeManifest(nil, `secretFrom:
+- metadata:
+    name: mysecret
+  files:
+  - `+dir+`/secrets.enc.yaml#.database.missing`)
+	_, _, err = generate(context.Background(), manifest, "")
+	if err == nil || !strings.Contains(err.Error(), "secrets.enc.yaml") {
+		t.Fatalf("expected error naming the file, got %v", err)
+	}
+}
+
+func TestGenerateSecretFromFileNameWithHash(t *testing.T) {
+	importTestKey(t)
+
+	data, err := os.ReadFile(testFixturePath(t, "test", "krm", "selector", "secrets.enc.yaml"))
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "team#1.enc.yaml"), data, 0o600); err != nil {
+		t.Fatalf("failed to write fixture: %v", err)
+	}
+	t.Chdir(dir)
+
+	manifest := makeManifest(nil, `secretFrom:
+- metadata:
+    name: mysecret
+  files:
+  - whole=team#1.enc.yaml
+  - db-password=team#1.enc.yaml#.database.password`)
+	got, _, err := generate(context.Background(), manifest, "")
+	if err != nil {
+		t.Fatalf("generate failed: %v", err)
+	}
+	for _, want := range []string{"whole: |", "db-password: 1f2d1e2e67df"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output missing %q:\n%s", want, got)
+		}
+	}
+}
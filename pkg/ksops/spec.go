@@ -0,0 +1,94 @@
+// Copyright 2026 viaduct.ai
+// SPDX-License-Identifier: Apache-2.0
+
+package ksops
+
+import (
+	"bytes"
+	"fmt"
+
+	goyaml "go.yaml.in/yaml/v3"
+	"sigs.k8s.io/kustomize/api/types"
+	"sigs.k8s.io/yaml"
+)
+
+// Spec is a ksops manifest: the encrypted files to decrypt as they are, and
+// the Secrets and ConfigMaps to generate from encrypted files and literals.
+type Spec struct {
+	Files         []FileSource         `json:"files,omitempty" yaml:"files,omitempty"`
+	SecretFrom    []SecretGenerator    `json:"secretFrom,omitempty" yaml:"secretFrom,omitempty"`
+	ConfigMapFrom []ConfigMapGenerator `json:"configMapFrom,omitempty" yaml:"configMapFrom,omitempty"`
+	// LoadRestrictor is LoadRestrictionsRootOnly, the default, or LoadRestrictionsNone.
+	// WithLoadRestrictor takes precedence when set. Without it,
+	// LoadRestrictionsNone is rejected, so that only the operator can lift the
+	// restriction.
+	LoadRestrictor string `json:"loadRestrictor,omitempty" yaml:"loadRestrictor,omitempty"`
+	// Timeout and FileTimeout limit the decryption of the whole manifest and of
+	// each file, as durations such as 30s. WithTimeout and WithFileTimeout take
+	// precedence when set.
+	Timeout     string `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	FileTimeout string `json:"fileTimeout,omitempty" yaml:"fileTimeout,omitempty"`
+}
+
+// SecretGenerator is a secretFrom entry, generating a Secret.
+type SecretGenerator struct {
+	Files       []FileSource `json:"files,omitempty" yaml:"files,omitempty"`
+	BinaryFiles []FileSource `json:"binaryFiles,omitempty" yaml:"binaryFiles,omitempty"`
+	Envs        []EnvSource  `json:"envs,omitempty" yaml:"envs,omitempty"`
+	Literals    []string     `json:"literals,omitempty" yaml:"literals,omitempty"`
+	// EncryptedLiterals is an inline SOPS encrypted map, including its sops
+	// metadata, as YAML. SOPS verifies its values in document order, so it is
+	// kept as written in the manifest.
+	EncryptedLiterals RawYAML           `json:"encryptedLiterals,omitempty" yaml:"encryptedLiterals,omitempty"`
+	Metadata          types.ObjectMeta  `json:"metadata,omitempty" yaml:"metadata,omitempty"`
+	Type              string            `json:"type,omitempty" yaml:"type,omitempty"`
+	Options           *GeneratorOptions `json:"options,omitempty" yaml:"options,omitempty"`
+	OnConflict        string            `json:"onConflict,omitempty" yaml:"onConflict,omitempty"`
+}
+
+// ConfigMapGenerator is a configMapFrom entry, generating a ConfigMap.
+type ConfigMapGenerator struct {
+	Files       []FileSource      `json:"files,omitempty" yaml:"files,omitempty"`
+	BinaryFiles []FileSource      `json:"binaryFiles,omitempty" yaml:"binaryFiles,omitempty"`
+	Envs        []EnvSource       `json:"envs,omitempty" yaml:"envs,omitempty"`
+	Metadata    types.ObjectMeta  `json:"metadata,omitempty" yaml:"metadata,omitempty"`
+	Options     *GeneratorOptions `json:"options,omitempty" yaml:"options,omitempty"`
+	OnConflict  string            `json:"onConflict,omitempty" yaml:"onConflict,omitempty"`
+}
+
+// RawYAML is a YAML value kept as written, such as the output of sops
+// --encrypt. The JSON conversion of a manifest sorts its keys, so manifests
+// fill it from their YAML nodes instead.
+type RawYAML []byte
+
+// UnmarshalYAML keeps the YAML of value.
+func (r *RawYAML) UnmarshalYAML(value *goyaml.Node) error {
+	b, err := goyaml.Marshal(value)
+	if err != nil {
+		return err
+	}
+	*r = b
+	return nil
+}
+
+// UnmarshalJSON keeps the JSON of a value, which is also YAML. A null value
+// leaves r unchanged.
+func (r *RawYAML) UnmarshalJSON(b []byte) error {
+	if bytes.Equal(b, []byte("null")) {
+		return nil
+	}
+	*r = bytes.Clone(b)
+	return nil
+}
+
+// MarshalJSON returns r as JSON.
+func (r RawYAML) MarshalJSON() ([]byte, error) {
+	if r == nil {
+		return []byte("null"), nil
+	}
+	b, err := yaml.YAMLToJSON(r)
+	if err != nil {
+		return nil, fmt.Errorf("error converting YAML to JSON: %w", err)
+	}
+	return b, nil
+}
@@ -0,0 +1,35 @@
+// Copyright 2026 viaduct.ai
+// SPDX-License-Identifier: Apache-2.0
+
+package ksops
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// decryptTimeout returns override, a timeout set on the Generator, or else
+// the timeout configured with the field of the spec. A timeout of 0, the
+// default, disables it.
+func decryptTimeout(override *time.Duration, field, configured string) (time.Duration, error) {
+	if override != nil {
+		if *override < 0 {
+			return 0, fmt.Errorf("invalid %s %s: must not be negative", field, *override)
+		}
+		return *override, nil
+	}
+	if configured == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(configured)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid %s %q: must be a non-negative duration such as 30s", field, configured)
+	}
+	return d, nil
+}
+
+// timeoutError is the cause of a context cancelled by a timeout.
+func timeoutError(name string, d time.Duration) error {
+	return fmt.Errorf("%s of %s exceeded: %w", name, d, context.DeadlineExceeded)
+}
@@ -0,0 +1,105 @@
+// Copyright 2026 viaduct.ai
+// SPDX-License-Identifier: Apache-2.0
+
+package ksops
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/getsops/sops/v3/cmd/sops/formats"
+)
+
+// stuckDecryptor blocks until ctx is done, as with a hung KMS call or a
+// gpg-agent waiting on pinentry.
+var stuckDecryptor = DecryptorFunc(func(ctx context.Context, data []byte, format formats.Format) ([]byte, error) {
+	<-ctx.Done()
+	return nil, context.Cause(ctx)
+})
+
+func TestDecryptTimeout(t *testing.T) {
+	minute := time.Minute
+	negative := -time.Second
+	tests := []struct {
+		name       string
+		override   *time.Duration
+		configured string
+		want       time.Duration
+		wantErr    bool
+	}{
+		{name: "disabled by default", want: 0},
+		{name: "function config", configured: "30s", want: 30 * time.Second},
+		{name: "option takes precedence", override: &minute, configured: "30s", want: time.Minute},
+		{name: "invalid", configured: "soon", wantErr: true},
+		{name: "negative", override: &negative, wantErr: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := decryptTimeout(tc.override, "timeout", tc.configured)
+			if tc.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "invalid timeout") {
+					t.Errorf("expected an invalid timeout error, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("decryptTimeout() = %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestDecryptAllCancelsOnFailure(t *testing.T) {
+	g := newTestDecryptGroup(t)
+	g.slots = make(chan struct{}, 1)
+
+	var attempted atomic.Int32
+	sentinel := errors.New("decrypt failed")
+	_, err := decryptAll(g, []string{"a", "b", "c"}, nil, func(_ context.Context, file string) (string, error) {
+		attempted.Add(1)
+		return "", sentinel
+	})
+	if !errors.Is(err, sentinel) {
+		t.Fatalf("expected the first failure, got %v", err)
+	}
+	if n := attempted.Load(); n != 1 {
+		t.Errorf("expected pending decryptions to be cancelled, %d were attempted", n)
+	}
+}
+
+func TestGenerateFileTimeout(t *testing.T) {
+	file := testFixturePath(t, "test", "legacy", "single", "secret.enc.yaml")
+	_, _, err := generate(context.Background(), makeManifest([]string{file}), "", WithFileTimeout(50*time.Millisecond), WithDecryptor(stuckDecryptor))
+	if err == nil {
+		t.Fatal("expected a timeout")
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected a deadline error, got %v", err)
+	}
+	for _, want := range []string{file, "pgp FBC7B9E2A4F9289AC0C1D4843D16CEE4A27381B4", "file timeout of 50ms exceeded"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error should contain %q: %v", want, err)
+		}
+	}
+}
+
+func TestGenerateOverallTimeout(t *testing.T) {
+	file := testFixturePath(t, "test", "legacy", "single", "secret.enc.yaml")
+	manifest := makeManifest([]string{file}, "timeout: 50ms")
+	_, _, err := generate(context.Background(), manifest, "", WithDecryptor(stuckDecryptor))
+	if err == nil {
+		t.Fatal("expected a timeout")
+	}
+	for _, want := range []string{file, "timeout of 50ms exceeded"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error should contain %q: %v", want, err)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright 2026 viaduct.ai
+// SPDX-License-Identifier: Apache-2.0
+
+package ksops
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"time"
+)
+
+// defaultTLSExpiryWarning is how long before a certificate expires KSOPS
+// starts warning about it, unless set with WithTLSExpiryWarning.
+const defaultTLSExpiryWarning = 30 * 24 * time.Hour
+
+// validateTLSSecret checks that the tls.crt and tls.key of a kubernetes.io/tls
+// Secret are a matching pair and that the certificate is currently valid. It
+// returns a warning if the certificate expires within window of now.
+func validateTLSSecret(s *kubernetesSecret, now time.Time, window time.Duration) (string, error) {
+	certPEM, _ := secretValue(s, "tls.crt")
+	keyPEM, _ := secretValue(s, "tls.key")
+
+	pair, err := tls.X509KeyPair([]byte(certPEM), []byte(keyPEM))
+	if err != nil {
+		return "", fmt.Errorf("invalid tls secret %q: %w", s.Metadata.Name, err)
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return "", fmt.Errorf("invalid tls secret %q: error parsing tls.crt: %w", s.Metadata.Name, err)
+	}
+	if err := checkCertificateDates(cert, now); err != nil {
+		return "", fmt.Errorf("invalid tls secret %q: tls.crt %w", s.Metadata.Name, err)
+	}
+
+	if caPEM, ok := secretValue(s, "ca.crt"); ok {
+		if err := validateCABundle([]byte(caPEM), now); err != nil {
+			return "", fmt.Errorf("invalid tls secret %q: ca.crt %w", s.Metadata.Name, err)
+		}
+	}
+
+	if window > 0 && cert.NotAfter.Before(now.Add(window)) {
+		return fmt.Sprintf("tls.crt certificate %q expires at %s, in %s",
+			cert.Subject.CommonName, cert.NotAfter.UTC().Format(time.RFC3339), cert.NotAfter.Sub(now).Round(time.Minute)), nil
+	}
+	return "", nil
+}
+
+// validateCABundle checks that data holds at least one PEM certificate and that
+// none of them have expired.
+func validateCABundle(data []byte, now time.Time) error {
+	var found bool
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return fmt.Errorf("error parsing certificate: %w", err)
+		}
+		if err := checkCertificateDates(cert, now); err != nil {
+			return err
+		}
+		found = true
+	}
+	if !found {
+		return fmt.Errorf("does not contain any PEM certificates")
+	}
+	return nil
+}
+
+// checkCertificateDates returns an error if cert is expired or not yet valid at now.
+func checkCertificateDates(cert *x509.Certificate, now time.Time) error {
+	if now.After(cert.NotAfter) {
+		return fmt.Errorf("certificate %q expired at %s", cert.Subject.CommonName, cert.NotAfter.UTC().Format(time.RFC3339))
+	}
+	if now.Before(cert.NotBefore) {
+		return fmt.Errorf("certificate %q is not valid before %s", cert.Subject.CommonName, cert.NotBefore.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
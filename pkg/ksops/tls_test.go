@@ -0,0 +1,175 @@
+// Copyright 2026 viaduct.ai
+// SPDX-License-Identifier: Apache-2.0
+
+package ksops
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GoogleContainerTools/kpt-functions-sdk/go/fn"
+)
+
+// newTestCertificate returns a PEM encoded self-signed certificate and its key,
+// valid between notBefore and notAfter.
+func newTestCertificate(t *testing.T, notBefore, notAfter time.Time) (string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "example.com"},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return string(certPEM), string(keyPEM)
+}
+
+func TestValidateTLSSecret(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	window := 30 * 24 * time.Hour
+
+	validCert, validKey := newTestCertificate(t, now.Add(-time.Hour), now.Add(365*24*time.Hour))
+	expiringCert, expiringKey := newTestCertificate(t, now.Add(-time.Hour), now.Add(7*24*time.Hour))
+	expiredCert, expiredKey := newTestCertificate(t, now.Add(-48*time.Hour), now.Add(-24*time.Hour))
+	futureCert, futureKey := newTestCertificate(t, now.Add(24*time.Hour), now.Add(48*time.Hour))
+	_, otherKey := newTestCertificate(t, now.Add(-time.Hour), now.Add(365*24*time.Hour))
+
+	tests := []struct {
+		name        string
+		data        map[string]string
+		window      time.Duration
+		wantWarning string
+		wantErr     string
+	}{
+		{
+			name:   "valid",
+			data:   map[string]string{"tls.crt": validCert, "tls.key": validKey},
+			window: window,
+		},
+		{
+			name:   "valid with ca",
+			data:   map[string]string{"tls.crt": validCert, "tls.key": validKey, "ca.crt": validCert},
+			window: window,
+		},
+		{
+			name:        "expiring within window",
+			data:        map[string]string{"tls.crt": expiringCert, "tls.key": expiringKey},
+			window:      window,
+			wantWarning: `certificate "example.com" expires at 2026-01-08T00:00:00Z, in 168h0m0s`,
+		},
+		{
+			name:   "expiring with warning disabled",
+			data:   map[string]string{"tls.crt": expiringCert, "tls.key": expiringKey},
+			window: 0,
+		},
+		{
+			name:    "expired",
+			data:    map[string]string{"tls.crt": expiredCert, "tls.key": expiredKey},
+			window:  window,
+			wantErr: `certificate "example.com" expired at 2025-12-31T00:00:00Z`,
+		},
+		{
+			name:    "not yet valid",
+			data:    map[string]string{"tls.crt": futureCert, "tls.key": futureKey},
+			window:  window,
+			wantErr: "is not valid before",
+		},
+		{
+			name:    "mismatched key",
+			data:    map[string]string{"tls.crt": validCert, "tls.key": otherKey},
+			window:  window,
+			wantErr: "private key does not match public key",
+		},
+		{
+			name:    "invalid pem",
+			data:    map[string]string{"tls.crt": "CERT", "tls.key": "KEY"},
+			window:  window,
+			wantErr: `invalid tls secret "mysecret"`,
+		},
+		{
+			name:    "expired ca",
+			data:    map[string]string{"tls.crt": validCert, "tls.key": validKey, "ca.crt": expiredCert},
+			window:  window,
+			wantErr: "ca.crt certificate",
+		},
+		{
+			name:    "ca without certificates",
+			data:    map[string]string{"tls.crt": validCert, "tls.key": validKey, "ca.crt": "CA"},
+			window:  window,
+			wantErr: "does not contain any PEM certificates",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s := &kubernetesSecret{Type: secretTypeTLS, StringData: tc.data}
+			s.Metadata.Name = "mysecret"
+			warning, err := validateTLSSecret(s, now, tc.window)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !strings.Contains(warning, tc.wantWarning) || (tc.wantWarning == "" && warning != "") {
+				t.Errorf("warning = %q, want %q", warning, tc.wantWarning)
+			}
+		})
+	}
+}
+
+func TestGenerateTLSExpiryWarning(t *testing.T) {
+	importTestKey(t)
+	// The fixture certificate is valid for 100 years, so a longer window always warns.
+
+	cert := testFixturePath(t, "test", "krm", "tls", "tls.enc.crt")
+	key := testFixturePath(t, "test", "krm", "tls", "tls.enc.key")
+	manifest := makeManifest(nil, `secretFrom:
+- metadata:
+    name: ingress-tls
+  type: kubernetes.io/tls
+  files:
+  - cert=`+cert+`
+  - key=`+key)
+
+	_, results, err := generate(context.Background(), manifest, "", WithTLSExpiryWarning(1000000*time.Hour))
+	if err != nil {
+		t.Fatalf("generate failed: %v", err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("expected 1 result, got %v", results)
+	}
+	r := results[0]
+	if r.Severity != fn.Warning || r.ResourceRef == nil || r.ResourceRef.Name != "ingress-tls" {
+		t.Errorf("unexpected result: %+v", r)
+	}
+	if !strings.Contains(r.Message, "expires at") {
+		t.Errorf("unexpected message: %q", r.Message)
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright 2026 viaduct.ai
+// SPDX-License-Identifier: Apache-2.0
+
+package ksops
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/GoogleContainerTools/kpt-functions-sdk/go/fn"
+	"github.com/getsops/sops/v3/cmd/sops/formats"
+)
+
+// orchestratorAnnotations are added to resources by kustomize and kpt before
+// they are passed to a function. They are not part of the encrypted file.
+var orchestratorAnnotations = []string{
+	"config.kubernetes.io/index",
+	"config.kubernetes.io/path",
+	"config.kubernetes.io/id",
+	"config.k8s.io/id",
+	"kustomize.config.k8s.io/id",
+}
+
+// isOrchestratorAnnotation reports whether an annotation was added by kustomize or kpt.
+func isOrchestratorAnnotation(key string) bool {
+	if strings.HasPrefix(key, "internal.config.kubernetes.io/") {
+		return true
+	}
+	for _, annotation := range orchestratorAnnotations {
+		if key == annotation {
+			return true
+		}
+	}
+	return false
+}
+
+// hasSOPSMetadata reports whether a resource is SOPS encrypted, that is whether
+// it has a top-level sops stanza with a MAC.
+func hasSOPSMetadata(obj *fn.KubeObject) bool {
+	_, found, err := obj.NestedString("sops", "mac")
+	return err == nil && found
+}
+
+// resource is an item of a ResourceList along with its YAML, serialized once
+// for its key providers, SOPS and placeholders.
+type resource struct {
+	obj *fn.KubeObject
+	// yaml is the YAML of obj, without the annotations set aside.
+	yaml []byte
+	// encrypted reports whether obj is SOPS encrypted.
+	encrypted bool
+	// annotations are the orchestrator annotations set aside from a SOPS
+	// encrypted resource, which are restored on the objects built from yaml.
+	annotations map[string]string
+}
+
+// newResource returns the resource of an item of a ResourceList. The
+// annotations added by the orchestrator are set aside from the YAML of a SOPS
+// encrypted item, as the SOPS MAC covers every value in the file. They are
+// removed from the item while it is serialized, and then restored.
+func newResource(obj *fn.KubeObject) (*resource, error) {
+	if !hasSOPSMetadata(obj) {
+		return &resource{obj: obj, yaml: []byte(obj.String())}, nil
+	}
+
+	added := make(map[string]string)
+	for k, v := range obj.GetAnnotations() {
+		if isOrchestratorAnnotation(k) {
+			added[k] = v
+			if _, err := obj.RemoveNestedField("metadata", "annotations", k); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := obj.RemoveAnnotationsIfEmpty(); err != nil {
+		return nil, err
+	}
+	r := &resource{obj: obj, yaml: []byte(obj.String()), encrypted: true, annotations: added}
+	if err := restoreAnnotations(obj, added); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// decryptResource decrypts a SOPS encrypted resource passed through the
+// ResourceList, restoring the annotations set aside from it.
+func (g *decryptGroup) decryptResource(ctx context.Context, r *resource) (*resource, error) {
+	data, err := g.decryptData(ctx, r.yaml, formats.Yaml)
+	if err != nil {
+		return nil, fmt.Errorf("trouble decrypting resource: %w", err)
+	}
+	decrypted, err := fn.ParseKubeObject(data)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing decrypted resource: %w", err)
+	}
+	if err := restoreAnnotations(decrypted, r.annotations); err != nil {
+		return nil, err
+	}
+	return &resource{obj: decrypted, yaml: data, annotations: r.annotations}, nil
+}
+
+// restoreAnnotations sets the annotations set aside from a resource on obj.
+func restoreAnnotations(obj *fn.KubeObject, annotations map[string]string) error {
+	for k, v := range annotations {
+		if err := obj.SetAnnotation(k, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+// Copyright 2026 viaduct.ai
+// SPDX-License-Identifier: Apache-2.0
+
+package ksops
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/GoogleContainerTools/kpt-functions-sdk/go/fn"
+)
+
+func TestIsOrchestratorAnnotation(t *testing.T) {
+	for key, want := range map[string]bool{
+		"config.kubernetes.io/index":                                      true,
+		"internal.config.kubernetes.io/annotations-migration-resource-id": true,
+		"kustomize.config.k8s.io/id":                                      true,
+		"config.k8s.io/id":                                                true,
+		"config.kubernetes.io/local-config":                               false,
+		"team":                                                            false,
+	} {
+		if got := isOrchestratorAnnotation(key); got != want {
+			t.Errorf("isOrchestratorAnnotation(%q) = %v, want %v", key, got, want)
+		}
+	}
+}
+
+func TestHasSOPSMetadata(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		want bool
+	}{
+		{name: "encrypted", yaml: "apiVersion: v1\nkind: Secret\nmetadata:\n  name: s\nsops:\n  mac: ENC[...]\n", want: true},
+		{name: "plain", yaml: "apiVersion: v1\nkind: Secret\nmetadata:\n  name: s\n", want: false},
+		{name: "sops without mac", yaml: "apiVersion: v1\nkind: Secret\nmetadata:\n  name: s\nsops: {}\n", want: false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			obj, err := fn.ParseKubeObject([]byte(tc.yaml))
+			if err != nil {
+				t.Fatalf("failed to parse object: %v", err)
+			}
+			if got := hasSOPSMetadata(obj); got != tc.want {
+				t.Errorf("hasSOPSMetadata() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestNewResource(t *testing.T) {
+	obj, err := fn.ParseKubeObject([]byte("apiVersion: v1\nkind: Secret\nmetadata:\n  name: s\n  annotations:\n    config.kubernetes.io/index: '0'\nsops:\n  mac: ENC[...]\n"))
+	if err != nil {
+		t.Fatalf("failed to parse object: %v", err)
+	}
+	r, err := newResource(obj)
+	if err != nil {
+		t.Fatalf("newResource() error = %v", err)
+	}
+	if !r.encrypted {
+		t.Errorf("newResource() encrypted = false, want true")
+	}
+	if strings.Contains(string(r.yaml), "config.kubernetes.io/index") {
+		t.Errorf("newResource() yaml keeps orchestrator annotation:\n%s", r.yaml)
+	}
+	if got := r.annotations["config.kubernetes.io/index"]; got != "0" {
+		t.Errorf("newResource() set aside index %q, want %q", got, "0")
+	}
+	if got := obj.GetAnnotation("config.kubernetes.io/index"); got != "0" {
+		t.Errorf("object index annotation = %q after newResource(), want %q", got, "0")
+	}
+}
+
+// transformerResourceList returns a ResourceList, as kustomize passes it to a
+// transformer, holding the encrypted fixture Secret and a plain ConfigMap.
+func transformerResourceList(t *testing.T) *fn.ResourceList {
+	t.Helper()
+	secret, err := os.ReadFile(testFixturePath(t, "test", "krm", "transformer", "secret.enc.yaml"))
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+	obj, err := fn.ParseKubeObject(secret)
+	if err != nil {
+		t.Fatalf("failed to parse fixture: %v", err)
+	}
+	obj.SetAnnotation("config.kubernetes.io/index", "0")
+	obj.SetAnnotation("internal.config.kubernetes.io/id", "1")
+
+	rl, err := fn.ParseResourceList([]byte(`apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: v1
+  kind: ConfigMap
+  metadata:
+    name: myconfig
+    annotations:
+      internal.config.kubernetes.io/id: "2"
+  data:
+    mode: plain
+functionConfig:
+  apiVersion: viaduct.ai/v1
+  kind: ksops
+  metadata:
+    name: ksops-decrypt-transformer
+`))
+	if err != nil {
+		t.Fatalf("failed to parse resource list: %v", err)
+	}
+	rl.Items = append(fn.KubeObjects{obj}, rl.Items...)
+	return rl
+}
+
+func TestKRMTransformer(t *testing.T) {
+	importTestKey(t)
+
+	rl := transformerResourceList(t)
+	if ok, err := krm(rl); !ok || err != nil {
+		t.Fatalf("krm failed: %v", err)
+	}
+	if len(rl.Items) != 2 {
+		t.Fatalf("expected 2 items, got %d", len(rl.Items))
+	}
+
+	secret := rl.Items[0]
+	if hasSOPSMetadata(secret) {
+		t.Error("secret should be decrypted")
+	}
+	if got := secret.GetMap("stringData").GetString("password"); got != "s3cr3t" {
+		t.Errorf("password = %q, want s3cr3t", got)
+	}
+	if got := secret.GetAnnotation("config.kubernetes.io/index"); got != "0" {
+		t.Errorf("orchestrator annotation was not restored: %v", secret.GetAnnotations())
+	}
+
+	configMap := rl.Items[1]
+	if configMap.GetName() != "myconfig" || configMap.GetMap("data").GetString("mode") != "plain" {
+		t.Errorf("plain resource was modified:\n%s", configMap)
+	}
+}
+
+func TestKRMTransformerDecryptionError(t *testing.T) {
+	importTestKey(t)
+
+	rl := transformerResourceList(t)
+	if err := rl.Items[0].SetNestedString("tampered", "stringData", "username"); err != nil {
+		t.Fatalf("failed to modify secret: %v", err)
+	}
+	_, err := krm(rl)
+	if err == nil {
+		t.Fatal("expected error for a tampered resource")
+	}
+	if !strings.Contains(err.Error(), `Secret "mysecret"`) {
+		t.Errorf("error should name the resource: %v", err)
+	}
+}